@@ -0,0 +1,61 @@
+package apis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/siriusa51/webtty/audit"
+	"github.com/siriusa51/webtty/session"
+	"log/slog"
+	"time"
+)
+
+// auditor writes the audit events of a request, stamped with who made it and from where.
+type auditor struct {
+	log    *slog.Logger
+	sink   audit.Sink
+	user   string
+	remote string
+}
+
+func (c *Controller) auditor(ctx *gin.Context) *auditor {
+	identity, _ := identityFromContext(ctx)
+	return &auditor{
+		log:    c.log,
+		sink:   c.config.Audit,
+		user:   identity.User,
+		remote: ctx.ClientIP(),
+	}
+}
+
+// Record writes an event about the session.
+func (a *auditor) Record(typ audit.EventType, sess *session.Session) {
+	a.write(a.event(typ, sess))
+}
+
+// RecordResize writes a resize event with the new size.
+func (a *auditor) RecordResize(sess *session.Session, width, height int) {
+	event := a.event(audit.EventResize, sess)
+	event.Width, event.Height = width, height
+	a.write(event)
+}
+
+func (a *auditor) event(typ audit.EventType, sess *session.Session) audit.Event {
+	return audit.Event{
+		Time:    time.Now(),
+		Type:    typ,
+		Sid:     sess.GetId(),
+		User:    a.user,
+		Remote:  a.remote,
+		Profile: sess.GetProfile(),
+		Command: sess.GetCommand(),
+	}
+}
+
+func (a *auditor) write(event audit.Event) {
+	if a.sink == nil {
+		return
+	}
+
+	if err := a.sink.Write(event); err != nil {
+		a.log.Warn("failed to write audit event", "event", event.Type, "sid", event.Sid, "error", err)
+	}
+}
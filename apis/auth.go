@@ -0,0 +1,241 @@
+package apis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/siriusa51/webtty/auth"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	authCookieName = "webtty_auth"
+	identityKey    = "webtty/identity"
+	// wsProtocol is the websocket subprotocol of the page, the server selects it when it is offered.
+	wsProtocol = "webtty"
+	// bearerProtocolPrefix starts the subprotocol a browser passes its bearer token in,
+	// as it can not set the Authorization header of a websocket.
+	bearerProtocolPrefix = "bearer."
+)
+
+// authenticator rejects requests without valid credentials.
+// Clients authenticate with a JWT bearer token, a verified TLS client certificate,
+// the login cookie issued by the login page, or with HTTP basic auth.
+type authenticator struct {
+	log        *slog.Logger
+	prefixPath string
+	htpasswd   *auth.Htpasswd
+	jwt        *auth.JWTVerifier
+	clientCert bool
+	signer     *auth.CookieSigner
+	upgrader   *websocket.Upgrader
+	// guesses limits the requests with HTTP basic auth per client address, before the password is checked
+	guesses *rateLimiter
+}
+
+func (a *authenticator) loginPath() string {
+	return path.Join(a.prefixPath, "/login")
+}
+
+// public returns true if the path can be requested without credentials.
+func (a *authenticator) public(p string) bool {
+	return (a.htpasswd != nil && p == a.loginPath()) || p == path.Join(a.prefixPath, "/favicon.ico")
+}
+
+func (a *authenticator) authenticate(ctx *gin.Context) (auth.Identity, bool) {
+	if token := bearerToken(ctx); token != "" && a.jwt != nil {
+		identity, err := a.jwt.Verify(token)
+		if err != nil {
+			a.log.Warn("invalid bearer token", "error", err, "remote", ctx.ClientIP())
+			return auth.Identity{}, false
+		}
+
+		return identity, true
+	}
+
+	if identity, ok := clientCertIdentity(ctx.Request); ok && a.clientCert {
+		return identity, true
+	}
+
+	if a.htpasswd == nil {
+		return auth.Identity{}, false
+	}
+
+	if cookie, err := ctx.Cookie(authCookieName); err == nil {
+		if identity, err := a.signer.Verify(cookie); err == nil {
+			return identity, true
+		}
+	}
+
+	if user, password, ok := ctx.Request.BasicAuth(); ok {
+		if a.htpasswd.Verify(user, password) {
+			return auth.Identity{User: user}, true
+		}
+
+		a.log.Warn("invalid basic auth credentials", "user", user, "remote", ctx.ClientIP())
+	}
+
+	return auth.Identity{}, false
+}
+
+// Middleware stores the identity of authenticated requests in the context and rejects the others.
+func (a *authenticator) Middleware(ctx *gin.Context) {
+	if a.public(ctx.Request.URL.Path) {
+		ctx.Next()
+		return
+	}
+
+	if _, _, ok := ctx.Request.BasicAuth(); ok && a.htpasswd != nil && !a.guesses.allow(ctx, "ip:"+ctx.ClientIP()) {
+		ctx.Abort()
+		return
+	}
+
+	identity, ok := a.authenticate(ctx)
+	if !ok {
+		a.reject(ctx)
+		return
+	}
+
+	ctx.Set(identityKey, identity)
+	ctx.Next()
+}
+
+func (a *authenticator) reject(ctx *gin.Context) {
+	defer ctx.Abort()
+
+	switch {
+	case websocket.IsWebSocketUpgrade(ctx.Request):
+		// the page can only learn why it was refused from the close code
+		upgraded, err := a.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+		if err != nil {
+			a.log.Error("failed to upgrade connection", "error", err)
+			return
+		}
+
+		conn := &wsConn{Conn: upgraded}
+		defer conn.Close()
+		writeWebSocketError(conn, ErrorAuthRequired, "authentication required")
+	case a.htpasswd != nil && ctx.Request.Method == http.MethodGet && strings.Contains(ctx.GetHeader("Accept"), "text/html"):
+		next := url.QueryEscape(ctx.Request.URL.RequestURI())
+		ctx.Redirect(http.StatusFound, a.loginPath()+"?next="+next)
+	default:
+		if a.htpasswd != nil {
+			ctx.Header("WWW-Authenticate", `Basic realm="webtty"`)
+		} else {
+			ctx.Header("WWW-Authenticate", `Bearer realm="webtty"`)
+		}
+		writeJSONResponse(ctx, http.StatusUnauthorized, JSONResponse{"error": "authentication required", "code": ErrorAuthRequired})
+	}
+}
+
+// LoginPage renders the login form.
+func (a *authenticator) LoginPage(ctx *gin.Context) {
+	ctx.HTML(http.StatusOK, "login.html", gin.H{
+		"prefix_path": path.Join(a.prefixPath, "/"),
+		"login_path":  a.loginPath(),
+		"next":        a.next(ctx.Query("next")),
+	})
+}
+
+// Login checks the submitted credentials and issues the login cookie.
+func (a *authenticator) Login(ctx *gin.Context) {
+	user := ctx.PostForm("user")
+	next := a.next(ctx.PostForm("next"))
+
+	if !a.htpasswd.Verify(user, ctx.PostForm("password")) {
+		a.log.Warn("failed login attempt", "user", user, "remote", ctx.ClientIP())
+		ctx.HTML(http.StatusUnauthorized, "login.html", gin.H{
+			"prefix_path": path.Join(a.prefixPath, "/"),
+			"login_path":  a.loginPath(),
+			"next":        next,
+			"error":       "Invalid user or password",
+		})
+		return
+	}
+
+	a.log.Info("user logged in", "user", user, "remote", ctx.ClientIP())
+	a.setCookie(ctx, a.signer.Sign(auth.Identity{User: user}), int(a.signer.TTL().Seconds()))
+	ctx.Redirect(http.StatusSeeOther, next)
+}
+
+// Logout removes the login cookie.
+func (a *authenticator) Logout(ctx *gin.Context) {
+	a.setCookie(ctx, "", -1)
+	ctx.Redirect(http.StatusSeeOther, a.loginPath())
+}
+
+func (a *authenticator) setCookie(ctx *gin.Context, value string, maxAge int) {
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(authCookieName, value, maxAge, path.Join(a.prefixPath, "/"), "", ctx.Request.TLS != nil, true)
+}
+
+// next returns where to go after login, only local paths are accepted to avoid open redirects.
+func (a *authenticator) next(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return path.Join(a.prefixPath, "/")
+	}
+
+	return next
+}
+
+// bearerToken returns the token of the Authorization header or of the bearer websocket subprotocol.
+// A token in the query has been moved to the header by tokenFromQuery.
+func bearerToken(ctx *gin.Context) string {
+	if scheme, token, ok := strings.Cut(ctx.GetHeader("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+
+	for _, protocol := range websocket.Subprotocols(ctx.Request) {
+		if token, ok := strings.CutPrefix(protocol, bearerProtocolPrefix); ok {
+			return token
+		}
+	}
+
+	return ""
+}
+
+// tokenFromQuery moves the token query parameter into the Authorization header before the request is logged,
+// so bearer tokens of clients that can only pass them in the URL, like EventSource, do not end up in the logs.
+func tokenFromQuery(ctx *gin.Context) {
+	query := ctx.Request.URL.Query()
+	if !query.Has("token") {
+		ctx.Next()
+		return
+	}
+
+	if ctx.GetHeader("Authorization") == "" {
+		ctx.Request.Header.Set("Authorization", "Bearer "+query.Get("token"))
+	}
+
+	query.Del("token")
+	ctx.Request.URL.RawQuery = query.Encode()
+	ctx.Next()
+}
+
+// clientCertIdentity returns the subject of the verified TLS client certificate as the identity.
+func clientCertIdentity(r *http.Request) (auth.Identity, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return auth.Identity{}, false
+	}
+
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	if subject.CommonName != "" {
+		return auth.Identity{User: subject.CommonName}, true
+	}
+
+	return auth.Identity{User: subject.String()}, true
+}
+
+// identityFromContext returns the authenticated identity of the request.
+func identityFromContext(ctx *gin.Context) (auth.Identity, bool) {
+	value, exist := ctx.Get(identityKey)
+	if !exist {
+		return auth.Identity{}, false
+	}
+
+	identity, ok := value.(auth.Identity)
+	return identity, ok
+}
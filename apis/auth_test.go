@@ -0,0 +1,77 @@
+package apis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/siriusa51/webtty/auth"
+	"github.com/siriusa51/webtty/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		header http.Header
+		want   string
+	}{
+		{"header", "/ws", http.Header{"Authorization": {"Bearer abc"}}, "abc"},
+		{"lower case scheme", "/ws", http.Header{"Authorization": {"bearer abc"}}, "abc"},
+		{"basic auth", "/ws", http.Header{"Authorization": {"Basic YTpi"}}, ""},
+		{"subprotocol", "/ws", http.Header{"Sec-Websocket-Protocol": {"webtty, bearer.a.b.c"}}, "a.b.c"},
+		{"query", "/ws?sid=1&token=abc", http.Header{}, "abc"},
+		{"header wins over query", "/ws?token=abc", http.Header{"Authorization": {"Bearer def"}}, "def"},
+		{"none", "/ws?sid=1", http.Header{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run("test bearerToken() "+tt.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest(http.MethodGet, tt.url, nil)
+			ctx.Request.Header = tt.header
+
+			tokenFromQuery(ctx)
+			assert.Equal(t, tt.want, bearerToken(ctx))
+			assert.NotContains(t, ctx.Request.URL.RequestURI(), "token")
+		})
+	}
+}
+
+func TestAuthenticator_Middleware(t *testing.T) {
+	t.Run("test Middleware() limits basic auth guesses", func(t *testing.T) {
+		hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		assert.NoError(t, err)
+		htpasswd, err := auth.ParseHtpasswd([]byte("alice:" + string(hash)))
+		assert.NoError(t, err)
+
+		signer, err := auth.NewCookieSigner(time.Hour)
+		assert.NoError(t, err)
+
+		log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
+		a := &authenticator{
+			log:      log,
+			htpasswd: htpasswd,
+			signer:   signer,
+			guesses:  newRateLimiter("basic auth", ratelimit.Limit{Rate: 0.001, Burst: 2}, log),
+		}
+
+		codes := make([]int, 0, 3)
+		for range 3 {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/sessions", nil)
+			ctx.Request.SetBasicAuth("alice", "guess")
+
+			a.Middleware(ctx)
+			codes = append(codes, recorder.Code)
+		}
+
+		assert.Equal(t, []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}, codes)
+	})
+}
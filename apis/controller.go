@@ -9,38 +9,98 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/siriusa51/webtty/audit"
+	"github.com/siriusa51/webtty/recorder"
 	"github.com/siriusa51/webtty/session"
+	"github.com/siriusa51/webtty/transcript"
 	"github.com/siriusa51/webtty/tty"
+	"github.com/siriusa51/webtty/vt"
 	"golang.org/x/sync/errgroup"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var SessionStopped = errors.New("session stopped")
 
+const (
+	// maxOutputFrameSize is the maximum number of output bytes sent in a single websocket frame.
+	maxOutputFrameSize = 4096
+	// maxWindowSize is the maximum width and height a client may ask a new session to have.
+	maxWindowSize = 1000
+)
+
+// The size a recording starts with, the first resize of the client follows right after.
+const (
+	defaultRecordWidth  = 80
+	defaultRecordHeight = 24
+)
+
+// Limits of the session output search, the query is at most maxSearchQuery bytes long.
+const (
+	maxSearchQuery       = 1024
+	defaultSearchContext = 2
+	maxSearchContext     = 20
+	defaultSearchLimit   = 100
+	maxSearchLimit       = 1000
+)
+
 type ControllerConfig struct {
-	Workdir  string
-	Command  string
-	ExtraEnv []string
+	PrefixPath string
+	// Profiles available to clients, the one named DefaultProfile is used when the client does not pick one.
+	Profiles []Profile
+	// AllowedOrigins are origin patterns besides the same origin that may open a websocket.
+	AllowedOrigins []string
+	// TrustedProxies may tell the scheme of the client for the same origin check.
+	TrustedProxies []netip.Prefix
+	// LegacySessions lets a websocket create the session for an unknown sid instead of only attaching.
+	LegacySessions bool
+	// Audit receives the audit events of the sessions, nil disables auditing.
+	Audit audit.Sink
+	// Recordings keeps the session recordings, nil disables recording.
+	Recordings *recorder.Store
+	// RecordAll records every session, otherwise only those of profiles with Record set.
+	RecordAll bool
+	// RecordingAdmins are the users who may watch every recording, the others only watch their own.
+	RecordingAdmins []string
+	// InputLogDir is where the input typed into the sessions is logged, empty disables input logging.
+	InputLogDir string
 }
 
 type Controller struct {
 	log      *slog.Logger
 	config   ControllerConfig
+	profiles map[string]Profile
 	mgr      *session.SessionManager
+	origins  *originChecker
 	upgrader *websocket.Upgrader
 }
 
 func NewController(config ControllerConfig, log *slog.Logger, mgr *session.SessionManager) *Controller {
+	profiles := make(map[string]Profile, len(config.Profiles))
+	for _, profile := range config.Profiles {
+		profiles[profile.Name] = profile
+	}
+
+	log = log.With("module", "apis/controller")
+	origins := newOriginChecker(config.AllowedOrigins, config.TrustedProxies, log)
 	return &Controller{
-		config: config,
-		log:    log.With("module", "apis/controller"),
-		mgr:    mgr,
+		config:   config,
+		profiles: profiles,
+		log:      log,
+		mgr:      mgr,
+		origins:  origins,
 		upgrader: &websocket.Upgrader{
 			ReadBufferSize:  4096,
 			WriteBufferSize: 4096,
-			CheckOrigin:     func(r *http.Request) bool { return true },
+			CheckOrigin:     origins.Check,
+			Subprotocols:    []string{wsProtocol},
 		},
 	}
 }
@@ -53,76 +113,538 @@ func (c *Controller) Websocket(ctx *gin.Context) {
 		return
 	}
 
-	conn, err := c.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	identity, _ := identityFromContext(ctx)
+
+	// the profile only matters when a legacy client creates the session by connecting
+	var profile Profile
+	if c.config.LegacySessions {
+		var exist bool
+		if profile, exist = c.profiles[ctx.DefaultQuery("profile", DefaultProfile)]; !exist {
+			writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "profile not found"})
+			return
+		}
+
+		if !identity.AllowsProfile(profile.Name) {
+			writeJSONResponse(ctx, http.StatusForbidden, JSONResponse{"error": "profile is not allowed"})
+			return
+		}
+	}
+
+	// offset is where the client's rendered output ends, -1 means a fresh attach.
+	offset := int64(-1)
+	if value := ctx.Query("offset"); value != "" {
+		var err error
+		if offset, err = strconv.ParseInt(value, 10, 64); err != nil || offset < 0 {
+			writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "invalid offset"})
+			return
+		}
+	}
+
+	upgraded, err := c.upgrader.Upgrade(ctx.Writer, ctx.Request, upgradeHeader(ctx))
 	if err != nil {
 		c.log.Error("failed to upgrade connection", "error", err)
 		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "failed to upgrade connection"})
 		return
 	}
 
+	conn := &wsConn{Conn: upgraded}
 	defer conn.Close()
 
-	session, err := c.mgr.GetSession(sid, func() (session.SessionIO, error) {
-		return tty.New(c.config.Command,
-			tty.WithWorkdir(c.config.Workdir),
-			tty.WithContext(ctx),
-			tty.WithExtraEnv(c.config.ExtraEnv...),
-		)
-	})
+	caller := callerFromContext(ctx)
+	trail := c.auditor(ctx)
+	var sess *session.Session
+	if c.config.LegacySessions {
+		// the factory is only called when the session does not exist yet
+		created := false
+		newIO := newSessionIO(profile, nil)
+		sess, err = c.mgr.GetSession(sid, caller, func() (session.SessionIO, error) {
+			created = true
+			return newIO()
+		}, c.sessionOptions(ctx, profile)...)
+
+		if err == nil && created {
+			trail.Record(audit.EventCreate, sess)
+		}
+	} else {
+		sess, err = c.mgr.AttachSession(sid, caller)
+	}
 
 	if err != nil {
-		c.log.Error("failed to get session", "error", err)
-		writeWebSocketJSONResponse(conn, JSONResponse{"error": err.Error()})
+		c.log.Error("failed to get session", "sid", sid, "error", err)
+		switch {
+		case errors.Is(err, session.ErrSessionLimit):
+			writeWebSocketError(conn, ErrorSessionLimit, err.Error())
+		case errors.Is(err, session.ErrSessionNotFound):
+			writeWebSocketError(conn, ErrorSessionNotFound, err.Error())
+		case errors.Is(err, session.ErrSessionForbidden):
+			writeWebSocketError(conn, ErrorForbidden, err.Error())
+		default:
+			writeWebSocketError(conn, ErrorInternal, err.Error())
+		}
 		return
 	}
 
 	log := c.log.With("sid", sid)
-	log.Info("session created")
+	if identity.User != "" {
+		log = log.With("user", identity.User)
+	}
+	log.Info("websocket attached")
 	defer func() { log.Info("websocket closed") }()
 
-	if err := session.Occupy(); err != nil {
+	if !identity.AllowsProfile(sess.GetProfile()) {
+		log.Warn("profile of session is not allowed", "profile", sess.GetProfile())
+		writeWebSocketError(conn, ErrorForbidden, "profile is not allowed")
+		return
+	}
+
+	if err := sess.Occupy(caller); err != nil {
 		log.Error("failed to occupy session", "error", err)
-		writeWebSocketJSONResponse(conn, JSONResponse{"error": err.Error()})
+		if errors.Is(err, session.ErrSessionForbidden) {
+			writeWebSocketError(conn, ErrorForbidden, err.Error())
+		} else {
+			writeWebSocketError(conn, ErrorSessionOccupied, err.Error())
+		}
 		return
 	}
 
-	defer session.Release()
+	defer sess.Release()
+
+	trail.Record(audit.EventAttach, sess)
+	defer trail.Record(audit.EventDetach, sess)
+
+	if !identity.Expiry.IsZero() {
+		// the connection must not outlive the credentials it was opened with
+		timer := time.AfterFunc(time.Until(identity.Expiry), func() {
+			log.Info("credentials expired")
+			writeWebSocketError(conn, ErrorAuthRequired, "credentials expired")
+		})
+		defer timer.Stop()
+	}
+
+	sessProfile := c.profiles[sess.GetProfile()]
 
 	eg, egctx := errgroup.WithContext(ctx)
-	eg.SetLimit(2)
-	eg.Go(ttyClientHandler(egctx, log, conn, session))
-	eg.Go(ttyServerHandler(egctx, log, conn, session))
+	eg.SetLimit(3)
+	eg.Go(ttyClientHandler(egctx, log, conn, sess, sessProfile, trail))
+	eg.Go(ttyServerHandler(egctx, log, conn, sess, offset))
+	if sessProfile.Clipboard.Forward {
+		eg.Go(ttyClipboardHandler(egctx, log, conn, sess))
+	}
 
 	if err := eg.Wait(); err != nil {
-		err = errors.Unwrap(err)
-		switch err.(type) {
-		case *websocket.CloseError:
-			break
+		var closeErr *websocket.CloseError
+		switch {
+		case errors.As(err, &closeErr), errors.Is(err, SessionStopped), errors.Is(err, os.ErrDeadlineExceeded):
+		case errors.Is(err, ErrProcessExited):
+			// the server handler has already told the client
+			log.Info("session process exited")
+		case errors.Is(err, ErrProtocol):
+			log.Warn("client violated protocol", "error", err)
+			writeWebSocketError(conn, ErrorProtocol, err.Error())
 		default:
-			if errors.Is(err, SessionStopped) {
-				break
-			}
-
-			if errors.Is(err, io.EOF) {
-				break
-			}
 			log.Error("failed to handle websocket", "error", err)
+			writeWebSocketError(conn, ErrorInternal, err.Error())
 		}
-		writeWebSocketJSONResponse(conn, JSONResponse{"error": err.Error()})
+	}
+}
+
+// CreateSession starts a session with a random id for the caller and returns the id.
+func (c *Controller) CreateSession(ctx *gin.Context) {
+	var req CreateSessionRequest
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "invalid request body"})
+		return
+	}
+
+	if req.Profile == "" {
+		req.Profile = DefaultProfile
+	}
+
+	profile, exist := c.profiles[req.Profile]
+	if !exist {
+		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "profile not found"})
 		return
 	}
+
+	if identity, _ := identityFromContext(ctx); !identity.AllowsProfile(profile.Name) {
+		writeJSONResponse(ctx, http.StatusForbidden, JSONResponse{"error": "profile is not allowed"})
+		return
+	}
+
+	if req.Width < 0 || req.Height < 0 || req.Width > maxWindowSize || req.Height > maxWindowSize {
+		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "invalid size"})
+		return
+	}
+
+	for _, entry := range req.Env {
+		name, _, ok := strings.Cut(entry, "=")
+		if !ok || name == "" {
+			writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "env must be KEY=VALUE"})
+			return
+		}
+
+		if !profile.EnvAllowed(name) {
+			writeJSONResponse(ctx, http.StatusForbidden, JSONResponse{"error": fmt.Sprintf("env %s is not allowed", name)})
+			return
+		}
+	}
+
+	sess, err := c.mgr.CreateSession(callerFromContext(ctx), newSessionIO(profile, req.Env), c.sessionOptions(ctx, profile)...)
+	if err != nil {
+		c.log.Error("failed to create session", "error", err)
+		if errors.Is(err, session.ErrSessionLimit) {
+			writeJSONResponse(ctx, http.StatusServiceUnavailable, JSONResponse{"error": err.Error(), "code": ErrorSessionLimit})
+		} else {
+			writeJSONResponse(ctx, http.StatusInternalServerError, JSONResponse{"error": err.Error()})
+		}
+		return
+	}
+
+	trail := c.auditor(ctx)
+	trail.Record(audit.EventCreate, sess)
+
+	if req.Width > 0 && req.Height > 0 {
+		if err := sess.ResizeWindow(req.Width, req.Height); err != nil {
+			c.log.Warn("failed to resize new session", "sid", sess.GetId(), "error", err)
+		} else {
+			trail.RecordResize(sess, req.Width, req.Height)
+		}
+	}
+
+	response := JSONResponse{"sid": sess.GetId(), "profile": profile.Name}
+	if err := sess.RecordingError(); err != nil {
+		response["warning"] = recordingWarning(err)
+	}
+
+	writeJSONResponse(ctx, http.StatusCreated, response)
+}
+
+// newSessionIO returns how to start the process of a session with the profile and the extra env.
+func newSessionIO(profile Profile, env []string) session.NewSessionIOFunc {
+	return func() (session.SessionIO, error) {
+		return tty.New(profile.Command,
+			tty.WithWorkdir(profile.Workdir),
+			tty.WithExtraEnv(append(append([]string{}, profile.ExtraEnv...), env...)...),
+		)
+	}
+}
+
+// sessionOptions returns the options of a session the request creates with the profile.
+func (c *Controller) sessionOptions(ctx *gin.Context, profile Profile) []session.OptionFunc {
+	identity, _ := identityFromContext(ctx)
+	optfs := []session.OptionFunc{
+		session.WithProfile(profile.Name),
+		session.WithClipboardPolicy(profile.Clipboard),
+		session.WithCommand(profile.Command),
+		session.WithUser(identity.User),
+	}
+
+	if c.config.Recordings != nil && (c.config.RecordAll || profile.Record) {
+		optfs = append(optfs, session.WithRecorder(c.newRecorder(profile, recordingOwner(ctx))))
+	}
+
+	if c.config.InputLogDir != "" {
+		optfs = append(optfs, session.WithInputLog(func(id string, start time.Time) (*recorder.InputLog, error) {
+			return recorder.CreateInputLog(c.config.InputLogDir, id, start)
+		}))
+	}
+
+	return optfs
+}
+
+// newRecorder returns how to create the recording of a session with the profile, owned by owner.
+func (c *Controller) newRecorder(profile Profile, owner string) session.NewRecorderFunc {
+	return func(id string, start time.Time) (recorder.Recorder, error) {
+		return c.config.Recordings.Create(id, owner, profile.Name, recorder.Header{
+			Width:     defaultRecordWidth,
+			Height:    defaultRecordHeight,
+			Timestamp: start,
+			Command:   profile.Command,
+			Title:     profile.Name,
+			Env:       map[string]string{"TERM": "xterm"},
+		})
+	}
 }
 
 // RemoveSession removes the session by sid.
 func (c *Controller) RemoveSession(ctx *gin.Context) {
 	sid := ctx.Query("sid")
-	c.mgr.RemoveSession(sid)
-	writeJSONResponse(ctx, http.StatusOK, JSONResponse{"sid": sid})
+	if sid == "" {
+		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "sid is required"})
+		return
+	}
+
+	// the session is looked up first to audit it, it may be gone by the time it is removed
+	sess, _ := c.mgr.FindSession(sid)
+	switch err := c.mgr.RemoveSession(sid, callerFromContext(ctx)); {
+	case err == nil:
+		if sess != nil {
+			c.auditor(ctx).Record(audit.EventRemove, sess)
+		}
+		writeJSONResponse(ctx, http.StatusOK, JSONResponse{"sid": sid})
+	case errors.Is(err, session.ErrSessionNotFound):
+		writeJSONResponse(ctx, http.StatusNotFound, JSONResponse{"error": err.Error()})
+	case errors.Is(err, session.ErrSessionForbidden):
+		writeJSONResponse(ctx, http.StatusForbidden, JSONResponse{"error": err.Error()})
+	default:
+		c.log.Error("failed to remove session", "sid", sid, "error", err)
+		writeJSONResponse(ctx, http.StatusInternalServerError, JSONResponse{"error": err.Error()})
+	}
+}
+
+// InviteParticipant lets another user attach to a session, only the owner of the session may invite.
+// Participants are authenticated users, so without authentication nobody can invite or be invited.
+func (c *Controller) InviteParticipant(ctx *gin.Context) {
+	if identity, _ := identityFromContext(ctx); identity.User == "" {
+		writeJSONResponse(ctx, http.StatusForbidden, JSONResponse{"error": "inviting participants requires authentication"})
+		return
+	}
+
+	sid := ctx.Query("sid")
+	sess, exist := c.mgr.FindSession(sid)
+	if !exist {
+		writeJSONResponse(ctx, http.StatusNotFound, JSONResponse{"error": "session not found"})
+		return
+	}
+
+	if sess.GetOwner() != callerFromContext(ctx) {
+		writeJSONResponse(ctx, http.StatusForbidden, JSONResponse{"error": "only the owner may invite participants"})
+		return
+	}
+
+	user := ctx.Query("user")
+	if user == "" {
+		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "user is required"})
+		return
+	}
+
+	sess.Invite(userCaller(user))
+	writeJSONResponse(ctx, http.StatusOK, JSONResponse{"sid": sid, "user": user})
+}
+
+// ListSessions lists the sessions with their title and working directory.
+func (c *Controller) ListSessions(ctx *gin.Context) {
+	identity, _ := identityFromContext(ctx)
+	caller := callerFromContext(ctx)
+	sessions := c.mgr.ListSessions()
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		if !sess.Allows(caller) || !identity.AllowsProfile(sess.GetProfile()) {
+			continue
+		}
+
+		infos = append(infos, SessionInfo{
+			Sid:      sess.GetId(),
+			Profile:  sess.GetProfile(),
+			Title:    sess.GetTitle(),
+			Cwd:      sess.GetCwd(),
+			Occupied: sess.Occupied(),
+		})
+	}
+
+	writeJSONResponse(ctx, http.StatusOK, JSONResponse{"sessions": infos})
+}
+
+// SignalSession sends a signal to the foreground process of the session.
+func (c *Controller) SignalSession(ctx *gin.Context) {
+	sid := ctx.Query("sid")
+	sess, ok := c.authorizedSession(ctx, sid)
+	if !ok {
+		return
+	}
+
+	sig, name, err := ParseSignal(ctx.Query("signal"))
+	if err != nil {
+		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": err.Error()})
+		return
+	}
+
+	if !c.profiles[sess.GetProfile()].SignalAllowed(name) {
+		writeJSONResponse(ctx, http.StatusForbidden, JSONResponse{"error": "signal is not allowed"})
+		return
+	}
+
+	if err := sess.Signal(sig); err != nil {
+		c.log.Error("failed to send signal", "sid", sid, "signal", name, "error", err)
+		writeJSONResponse(ctx, http.StatusInternalServerError, JSONResponse{"error": err.Error()})
+		return
+	}
+
+	writeJSONResponse(ctx, http.StatusOK, JSONResponse{"sid": sid, "signal": name})
+}
+
+// SessionTranscript downloads the retained output of the session, as plain text or as HTML with its colors.
+func (c *Controller) SessionTranscript(ctx *gin.Context) {
+	sid := ctx.Param("sid")
+	sess, ok := c.authorizedSession(ctx, sid)
+	if !ok {
+		return
+	}
+
+	var buff bytes.Buffer
+	var contentType string
+	output := sess.Output()
+	format := ctx.DefaultQuery("format", "txt")
+
+	switch format {
+	case "txt":
+		contentType = "text/plain; charset=utf-8"
+		_ = transcript.Text(&buff, output.Data)
+	case "html":
+		contentType = "text/html; charset=utf-8"
+		_ = transcript.HTML(&buff, "webtty session "+sid, output.Data)
+	default:
+		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "invalid format, expected txt or html"})
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, sid, format))
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(http.StatusOK, contentType, buff.Bytes())
+}
+
+// SessionScreen returns what the terminal of the session currently shows, as plain text,
+// as JSON with the colors and the cursor, or as an SVG image.
+func (c *Controller) SessionScreen(ctx *gin.Context) {
+	sid := ctx.Param("sid")
+	sess, ok := c.authorizedSession(ctx, sid)
+	if !ok {
+		return
+	}
+
+	screen := sess.Screen()
+	ctx.Header("Cache-Control", "no-store")
+
+	switch ctx.DefaultQuery("format", "text") {
+	case "text":
+		var buff bytes.Buffer
+		_ = screen.Text(&buff)
+		ctx.Data(http.StatusOK, "text/plain; charset=utf-8", buff.Bytes())
+	case "json":
+		writeJSONResponse(ctx, http.StatusOK, newScreenResponse(screen, sess.GetTitle()))
+	case "svg":
+		var buff bytes.Buffer
+		_ = screen.SVG(&buff, "webtty session "+sid)
+		ctx.Data(http.StatusOK, "image/svg+xml", buff.Bytes())
+	default:
+		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "invalid format, expected text, json or svg"})
+	}
+}
+
+func newScreenResponse(screen vt.Snapshot, title string) ScreenResponse {
+	response := ScreenResponse{
+		Width:     screen.Width,
+		Height:    screen.Height,
+		Title:     title,
+		AltScreen: screen.AltScreen,
+		Cursor:    ScreenCursor{X: screen.CursorX, Y: screen.CursorY, Visible: screen.CursorVisible},
+		Lines:     make([]ScreenLine, len(screen.Lines)),
+	}
+
+	for y, cells := range screen.Lines {
+		line := ScreenLine{Text: vt.LineText(cells), Spans: []ScreenSpan{}}
+		for _, span := range vt.Spans(cells) {
+			line.Spans = append(line.Spans, ScreenSpan{
+				Text:  span.Text,
+				X:     span.X,
+				Fg:    span.Style.Fg.Hex(),
+				Bg:    span.Style.Bg.Hex(),
+				Attrs: span.Style.Attrs.Names(),
+			})
+		}
+		response.Lines[y] = line
+	}
+
+	return response
+}
+
+// SessionSearch searches the retained output of the session for the q query parameter, a regular expression
+// if regex=1, and returns the matching lines without escape sequences with the lines around them.
+func (c *Controller) SessionSearch(ctx *gin.Context) {
+	sid := ctx.Param("sid")
+	sess, ok := c.authorizedSession(ctx, sid)
+	if !ok {
+		return
+	}
+
+	query := ctx.Query("q")
+	if query == "" || len(query) > maxSearchQuery {
+		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "invalid q"})
+		return
+	}
+
+	isRegex := ctx.Query("regex") == "1"
+	pattern := query
+	if !isRegex {
+		pattern = regexp.QuoteMeta(query)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": fmt.Sprintf("invalid regex: %s", err)})
+		return
+	}
+
+	around, ok := queryInt(ctx, "context", defaultSearchContext, 0, maxSearchContext)
+	if !ok {
+		return
+	}
+
+	limit, ok := queryInt(ctx, "limit", defaultSearchLimit, 1, maxSearchLimit)
+	if !ok {
+		return
+	}
+
+	output := sess.Output()
+	matches, truncated := transcript.Search(output.Data, re, around, limit)
+
+	response := SearchResponse{
+		Query:     query,
+		Regex:     isRegex,
+		Start:     output.Offset,
+		End:       output.Offset + int64(len(output.Data)),
+		Matches:   make([]SearchMatch, 0, len(matches)),
+		Truncated: truncated,
+	}
+
+	for _, match := range matches {
+		response.Matches = append(response.Matches, SearchMatch{
+			Offset: output.Offset + int64(match.Offset),
+			Line:   match.Line,
+			Before: match.Before,
+			After:  match.After,
+		})
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	writeJSONResponse(ctx, http.StatusOK, response)
+}
+
+// authorizedSession returns the session with the sid if the client may use it,
+// otherwise it answers the request and returns false.
+func (c *Controller) authorizedSession(ctx *gin.Context, sid string) (*session.Session, bool) {
+	sess, exist := c.mgr.FindSession(sid)
+	if !exist {
+		writeJSONResponse(ctx, http.StatusNotFound, JSONResponse{"error": "session not found"})
+		return nil, false
+	}
+
+	if !sess.Allows(callerFromContext(ctx)) {
+		writeJSONResponse(ctx, http.StatusForbidden, JSONResponse{"error": session.ErrSessionForbidden.Error()})
+		return nil, false
+	}
+
+	if identity, _ := identityFromContext(ctx); !identity.AllowsProfile(sess.GetProfile()) {
+		writeJSONResponse(ctx, http.StatusForbidden, JSONResponse{"error": "profile is not allowed"})
+		return nil, false
+	}
+
+	return sess, true
 }
 
 // ttyClientHandler handles the client side of the tty.
 // It reads the client and writes to the session.
-func ttyClientHandler(ctx context.Context, log *slog.Logger, conn *websocket.Conn, sess *session.Session) func() error {
+func ttyClientHandler(ctx context.Context, log *slog.Logger, conn *wsConn, sess *session.Session, profile Profile, trail *auditor) func() error {
 	return func() error {
 		log.Info("tty client handler started")
 		defer func() { log.Info("tty client handler stopped") }()
@@ -142,11 +664,11 @@ func ttyClientHandler(ctx context.Context, log *slog.Logger, conn *websocket.Con
 				}
 
 				if mt != websocket.TextMessage {
-					return fmt.Errorf("invalid message type: %d", mt)
+					return fmt.Errorf("%w: invalid message type: %d", ErrProtocol, mt)
 				}
 
 				if len(message) == 0 {
-					return fmt.Errorf("empty message")
+					return fmt.Errorf("%w: empty message", ErrProtocol)
 				}
 
 				switch message[0] {
@@ -155,6 +677,7 @@ func ttyClientHandler(ctx context.Context, log *slog.Logger, conn *websocket.Con
 						continue
 					}
 
+					sess.LogInput(trail.user, message[1:])
 					if _, err := io.Copy(sess, bytes.NewBuffer(message[1:])); err != nil {
 						log.Warn("failed to write message to session", "error", err)
 					}
@@ -162,19 +685,41 @@ func ttyClientHandler(ctx context.Context, log *slog.Logger, conn *websocket.Con
 				case ResizeTerminal:
 					var resizeMessage ResizeMessage
 					if err := json.Unmarshal(message[1:], &resizeMessage); err != nil {
-						return fmt.Errorf("failed to unmarshal resize message: %w", err)
+						return fmt.Errorf("%w: failed to unmarshal resize message: %w", ErrProtocol, err)
 					}
 
 					if err := sess.ResizeWindow(resizeMessage.Width, resizeMessage.Height); err != nil {
 						return fmt.Errorf("failed to resize terminal: %w", err)
 					}
+
+					trail.RecordResize(sess, resizeMessage.Width, resizeMessage.Height)
+				case Signal:
+					var signalMessage SignalMessage
+					if err := json.Unmarshal(message[1:], &signalMessage); err != nil {
+						return fmt.Errorf("%w: failed to unmarshal signal message: %w", ErrProtocol, err)
+					}
+
+					sig, name, err := ParseSignal(signalMessage.Signal)
+					if err != nil {
+						log.Warn("invalid signal from client", "error", err)
+						continue
+					}
+
+					if !profile.SignalAllowed(name) {
+						log.Warn("signal is not allowed", "signal", name, "profile", profile.Name)
+						continue
+					}
+
+					if err := sess.Signal(sig); err != nil {
+						log.Warn("failed to send signal to session", "signal", name, "error", err)
+					}
 				case Ping:
 					pong := string(Pong) + "pong"
 					if err := conn.WriteMessage(websocket.TextMessage, []byte(pong)); err != nil {
 						return fmt.Errorf("failed to write pong message to client: %w", err)
 					}
 				default:
-					return fmt.Errorf("invalid message type: %d", message[0])
+					return fmt.Errorf("%w: invalid message type: %d", ErrProtocol, message[0])
 				}
 			}
 		}
@@ -182,39 +727,153 @@ func ttyClientHandler(ctx context.Context, log *slog.Logger, conn *websocket.Con
 }
 
 // ttyServerHandler handles the server side of the tty.
-// It reads the session and writes to the client.
-func ttyServerHandler(ctx context.Context, log *slog.Logger, conn *websocket.Conn, sess *session.Session) func() error {
+// It reads the session output starting at offset and writes it to the client.
+// A negative offset, or an offset that is no longer retained, starts with a repaint of the current screen.
+func ttyServerHandler(ctx context.Context, log *slog.Logger, conn *wsConn, sess *session.Session, offset int64) func() error {
 	return func() error {
-		log.Info("tty server handler started")
+		log.Info("tty server handler started", "offset", offset)
+		defer func() { log.Info("tty server handler stopped") }()
+
+		var title, cwd string
+
+		// the title and cwd are parsed from the output, so they can only change along with it
+		sendState := func() error {
+			if value := sess.GetTitle(); value != title {
+				title = value
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(string(WindowTitle)+title)); err != nil {
+					return fmt.Errorf("failed to write title message to client: %w", err)
+				}
+			}
+
+			if value := sess.GetCwd(); value != cwd {
+				cwd = value
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(string(WorkingDirectory)+cwd)); err != nil {
+					return fmt.Errorf("failed to write cwd message to client: %w", err)
+				}
+			}
+
+			return nil
+		}
 
-		defer func() {
-			log.Info("tty server handler stopped")
+		// replaying raw output leaves full screen applications garbled, the screen is repainted instead
+		repaint := func() error {
+			chunk := sess.Repaint()
+			offset = chunk.Offset
 
-			data := string(Closed) + "session closed"
+			data := string(Repaint) + strconv.FormatInt(chunk.Offset, 10) + ":" + base64.StdEncoding.EncodeToString(chunk.Data)
 			if err := conn.WriteMessage(websocket.TextMessage, []byte(data)); err != nil {
-				log.Warn("failed to write closed message to client", "error", err)
+				return fmt.Errorf("failed to write repaint message to client: %w", err)
 			}
-		}()
 
-		buff := make([]byte, 4096)
+			return sendState()
+		}
+
+		// recordings fail to start or while output is recorded, so checking along with the output is enough
+		recordingWarned := false
+		warnRecording := func() error {
+			if recordingWarned || sess.RecordingError() == nil {
+				return nil
+			}
+
+			recordingWarned = true
+			if err := writeWebSocketWarning(conn, ErrorRecordingDisabled, recordingWarning(sess.RecordingError())); err != nil {
+				return fmt.Errorf("failed to write warning message to client: %w", err)
+			}
+
+			return nil
+		}
+
+		if err := warnRecording(); err != nil {
+			return err
+		}
+
+		if offset < 0 {
+			if err := repaint(); err != nil {
+				return err
+			}
+		}
 
 		for {
-			select {
-			case <-ctx.Done():
-				return SessionStopped
-			default:
-				n, err := sess.Read(buff)
-				if err != nil {
-					return fmt.Errorf("failed to read message from session: %w", err)
+			chunk, err := sess.ReadOutput(ctx, offset, maxOutputFrameSize)
+			if err != nil {
+				if ctx.Err() != nil {
+					return SessionStopped
+				}
+
+				if errors.Is(err, io.EOF) {
+					data := string(Closed) + "session closed"
+					if err := conn.WriteMessage(websocket.TextMessage, []byte(data)); err != nil {
+						log.Warn("failed to write closed message to client", "error", err)
+					}
+
+					writeWebSocketError(conn, ErrorProcessExited, "session process exited")
+					return ErrProcessExited
+				}
+
+				return fmt.Errorf("failed to read message from session: %w", err)
+			}
+
+			if chunk.Offset != offset {
+				log.Warn("client missed output", "from", offset, "to", chunk.Offset)
+
+				gap, _ := json.Marshal(OutputGapMessage{From: offset, To: chunk.Offset})
+				if err := conn.WriteMessage(websocket.TextMessage, append([]byte{OutputGap}, gap...)); err != nil {
+					return fmt.Errorf("failed to write gap message to client: %w", err)
 				}
 
-				data := string(Output) + base64.StdEncoding.EncodeToString(buff[:n])
-				if err := conn.WriteMessage(websocket.TextMessage, []byte(data)); err != nil {
-					return fmt.Errorf("failed to write message to client: %w", err)
+				if err := repaint(); err != nil {
+					return err
 				}
+				continue
+			}
+
+			offset = chunk.Offset + int64(len(chunk.Data))
+			if len(chunk.Data) == 0 {
+				continue
+			}
+
+			data := string(Output) + strconv.FormatInt(chunk.Offset, 10) + ":" + base64.StdEncoding.EncodeToString(chunk.Data)
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(data)); err != nil {
+				return fmt.Errorf("failed to write message to client: %w", err)
+			}
+
+			if err := sendState(); err != nil {
+				return err
+			}
+
+			if err := warnRecording(); err != nil {
+				return err
 			}
 		}
+	}
+}
+
+// ttyClipboardHandler forwards the clipboard writes of the session to the client.
+// Only writes made while the client is attached are forwarded.
+func ttyClipboardHandler(ctx context.Context, log *slog.Logger, conn *wsConn, sess *session.Session) func() error {
+	return func() error {
+		log.Info("tty clipboard handler started")
+		defer func() { log.Info("tty clipboard handler stopped") }()
 
-		return SessionStopped
+		seq := sess.ClipboardSeq()
+		for {
+			events, err := sess.ReadClipboard(ctx, seq)
+			if errors.Is(err, io.EOF) {
+				// the server handler reports the end of the session
+				return nil
+			}
+
+			if err != nil {
+				return SessionStopped
+			}
+
+			for _, event := range events {
+				seq = event.Seq
+				data, _ := json.Marshal(ClipboardMessage{Selection: event.Selection, Data: event.Data})
+				if err := conn.WriteMessage(websocket.TextMessage, append([]byte{Clipboard}, data...)); err != nil {
+					return fmt.Errorf("failed to write clipboard message to client: %w", err)
+				}
+			}
+		}
 	}
 }
@@ -0,0 +1,225 @@
+package apis
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/siriusa51/webtty/auth"
+	"github.com/siriusa51/webtty/session"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestContext returns the context of a request by the browser with the secret, authenticated as identity.
+func newTestContext(identity auth.Identity, secret string) (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx.Set(identityKey, identity)
+	ctx.Set(clientKey, secret)
+	return ctx, recorder
+}
+
+func TestController_CreateSession(t *testing.T) {
+	mgr := session.NewSessionManager()
+	ctrl := NewController(ControllerConfig{
+		Profiles: []Profile{
+			{Name: DefaultProfile, Command: "sh -c env;cat", AllowedEnv: []string{"WEBTTY_TEST"}},
+			{Name: "ops", Command: "sh -c env;cat"},
+		},
+	}, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})), mgr)
+
+	tests := []struct {
+		name     string
+		identity auth.Identity
+		body     string
+		want     int
+	}{
+		{"invalid body", auth.Identity{}, `{"profile":`, http.StatusBadRequest},
+		{"unknown profile", auth.Identity{}, `{"profile": "htop"}`, http.StatusBadRequest},
+		{"profile not allowed", auth.Identity{User: "alice", Profiles: []string{DefaultProfile}}, `{"profile": "ops"}`, http.StatusForbidden},
+		{"negative size", auth.Identity{}, `{"width": -1, "height": 40}`, http.StatusBadRequest},
+		{"oversized width", auth.Identity{}, `{"width": 100000, "height": 40}`, http.StatusBadRequest},
+		{"oversized height", auth.Identity{}, `{"width": 120, "height": 1001}`, http.StatusBadRequest},
+		{"env without value", auth.Identity{}, `{"env": ["WEBTTY_TEST"]}`, http.StatusBadRequest},
+		{"env without name", auth.Identity{}, `{"env": ["=1"]}`, http.StatusBadRequest},
+		{"env not allowed", auth.Identity{}, `{"env": ["LD_PRELOAD=/tmp/x.so"]}`, http.StatusForbidden},
+		{"env of another profile", auth.Identity{}, `{"profile": "ops", "env": ["WEBTTY_TEST=1"]}`, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run("test CreateSession() "+tt.name, func(t *testing.T) {
+			ctx, recorder := newTestContext(tt.identity, "secret")
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/sessions", strings.NewReader(tt.body))
+
+			ctrl.CreateSession(ctx)
+			assert.Equal(t, tt.want, recorder.Code)
+			assert.Empty(t, mgr.ListSessions())
+		})
+	}
+
+	t.Run("test CreateSession() allowed env", func(t *testing.T) {
+		ctx, recorder := newTestContext(auth.Identity{}, "secret")
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/sessions",
+			strings.NewReader(`{"width": 120, "height": 40, "env": ["WEBTTY_TEST=allowed"]}`))
+
+		ctrl.CreateSession(ctx)
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+
+		sessions := mgr.ListSessions()
+		if !assert.Len(t, sessions, 1) {
+			return
+		}
+		sess := sessions[0]
+		defer mgr.RemoveSession(sess.GetId(), callerFromContext(ctx))
+
+		// the process prints its environment, which has to contain the variable
+		readCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var output string
+		for offset := int64(0); !strings.Contains(output, "WEBTTY_TEST=allowed"); {
+			chunk, err := sess.ReadOutput(readCtx, offset, maxOutputFrameSize)
+			if err != nil {
+				break
+			}
+			output += string(chunk.Data)
+			offset = chunk.Offset + int64(len(chunk.Data))
+		}
+		assert.Contains(t, output, "WEBTTY_TEST=allowed")
+	})
+}
+
+func TestController_Websocket(t *testing.T) {
+	mgr := session.NewSessionManager()
+	ctrl := NewController(ControllerConfig{
+		Profiles: []Profile{{Name: DefaultProfile, Command: "cat"}},
+	}, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})), mgr)
+
+	router := gin.New()
+	router.GET("/ws", ctrl.Websocket)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	t.Run("test Websocket() attach to a missing session", func(t *testing.T) {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?sid=missing", nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		for err == nil {
+			_, _, err = conn.ReadMessage()
+		}
+		assert.True(t, websocket.IsCloseError(err, CloseSessionNotFound), "unexpected error: %v", err)
+		assert.False(t, mgr.HasSession("missing"))
+	})
+
+	t.Run("test Websocket() without sid", func(t *testing.T) {
+		ctx, recorder := newTestContext(auth.Identity{}, "secret")
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/ws", nil)
+
+		ctrl.Websocket(ctx)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
+
+func TestController_authorizedSession(t *testing.T) {
+	mgr := session.NewSessionManager()
+	ctrl := NewController(ControllerConfig{}, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})), mgr)
+
+	owner, _ := newTestContext(auth.Identity{}, "owner")
+	sess, err := mgr.CreateSession(callerFromContext(owner), func() (session.SessionIO, error) {
+		return newPipeSessionIO(), nil
+	}, session.WithProfile(DefaultProfile))
+	assert.NoError(t, err)
+	defer mgr.RemoveSession(sess.GetId(), callerFromContext(owner))
+
+	tests := []struct {
+		name     string
+		identity auth.Identity
+		secret   string
+		sid      string
+		want     int
+	}{
+		{"owner", auth.Identity{}, "owner", sess.GetId(), http.StatusOK},
+		{"unknown session", auth.Identity{}, "owner", "unknown", http.StatusNotFound},
+		{"other client", auth.Identity{}, "other", sess.GetId(), http.StatusForbidden},
+		{"profile not allowed", auth.Identity{Profiles: []string{"ops"}}, "owner", sess.GetId(), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run("test authorizedSession() "+tt.name, func(t *testing.T) {
+			ctx, recorder := newTestContext(tt.identity, tt.secret)
+			found, ok := ctrl.authorizedSession(ctx, tt.sid)
+
+			assert.Equal(t, tt.want == http.StatusOK, ok)
+			if ok {
+				assert.Same(t, sess, found)
+			} else {
+				assert.Equal(t, tt.want, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestController_RemoveSession(t *testing.T) {
+	mgr := session.NewSessionManager()
+	ctrl := NewController(ControllerConfig{}, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})), mgr)
+
+	owner, _ := newTestContext(auth.Identity{}, "owner")
+	sess, err := mgr.CreateSession(callerFromContext(owner), func() (session.SessionIO, error) {
+		return newPipeSessionIO(), nil
+	})
+	assert.NoError(t, err)
+
+	remove := func(secret string, sid string) int {
+		ctx, recorder := newTestContext(auth.Identity{}, secret)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/remove_session?sid="+sid, nil)
+		ctrl.RemoveSession(ctx)
+		return recorder.Code
+	}
+
+	t.Run("test RemoveSession()", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, remove("other", sess.GetId()))
+		assert.Equal(t, http.StatusOK, remove("owner", sess.GetId()))
+		assert.Equal(t, http.StatusNotFound, remove("owner", sess.GetId()))
+		assert.Equal(t, http.StatusBadRequest, remove("owner", ""))
+	})
+}
+
+func TestController_InviteParticipant(t *testing.T) {
+	mgr := session.NewSessionManager()
+	ctrl := NewController(ControllerConfig{}, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})), mgr)
+
+	alice, _ := newTestContext(auth.Identity{User: "alice"}, "")
+	sess, err := mgr.CreateSession(callerFromContext(alice), func() (session.SessionIO, error) {
+		return newPipeSessionIO(), nil
+	})
+	assert.NoError(t, err)
+	defer mgr.RemoveSession(sess.GetId(), callerFromContext(alice))
+
+	invite := func(identity auth.Identity, secret string, user string) int {
+		ctx, recorder := newTestContext(identity, secret)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/invite?sid="+sess.GetId()+"&user="+user, nil)
+		ctrl.InviteParticipant(ctx)
+		return recorder.Code
+	}
+
+	t.Run("test InviteParticipant()", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, invite(auth.Identity{User: "bob"}, "", "bob"))
+		assert.Equal(t, http.StatusBadRequest, invite(auth.Identity{User: "alice"}, "", ""))
+		assert.Equal(t, http.StatusOK, invite(auth.Identity{User: "alice"}, "", "bob"))
+		assert.True(t, sess.Allows(userCaller("bob")))
+	})
+
+	t.Run("test InviteParticipant() without authentication", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, invite(auth.Identity{}, "secret", "bob"))
+	})
+}
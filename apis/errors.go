@@ -0,0 +1,65 @@
+package apis
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrProtocol      = errors.New("protocol error")
+	ErrProcessExited = errors.New("process exited")
+)
+
+// ErrorCode identifies why the server failed a websocket connection, so clients can react programmatically.
+type ErrorCode string
+
+const (
+	ErrorSessionOccupied ErrorCode = "session_occupied"
+	ErrorSessionLimit    ErrorCode = "session_limit"
+	ErrorAuthRequired    ErrorCode = "auth_required"
+	ErrorForbidden       ErrorCode = "forbidden"
+	ErrorSessionNotFound ErrorCode = "session_not_found"
+	ErrorRateLimited     ErrorCode = "rate_limited"
+	ErrorProcessExited   ErrorCode = "process_exited"
+	ErrorProtocol        ErrorCode = "protocol_error"
+	ErrorInternal        ErrorCode = "internal_error"
+	// ErrorRecordingDisabled is only sent as a warning, the connection stays open.
+	ErrorRecordingDisabled ErrorCode = "recording_disabled"
+)
+
+// Websocket close codes of the error codes, 4000-4999 are reserved for applications.
+const (
+	CloseSessionOccupied = 4001
+	CloseSessionLimit    = 4002
+	CloseAuthRequired    = 4003
+	CloseProcessExited   = 4004
+	CloseForbidden       = 4005
+	CloseSessionNotFound = 4006
+)
+
+// CloseCode returns the websocket close code sent along with the error code.
+func (code ErrorCode) CloseCode() int {
+	switch code {
+	case ErrorSessionOccupied:
+		return CloseSessionOccupied
+	case ErrorSessionLimit:
+		return CloseSessionLimit
+	case ErrorAuthRequired:
+		return CloseAuthRequired
+	case ErrorProcessExited:
+		return CloseProcessExited
+	case ErrorForbidden:
+		return CloseForbidden
+	case ErrorSessionNotFound:
+		return CloseSessionNotFound
+	case ErrorProtocol:
+		return websocket.CloseProtocolError
+	default:
+		return websocket.CloseInternalServerErr
+	}
+}
+
+type ErrorMessage struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
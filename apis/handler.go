@@ -3,36 +3,159 @@ package apis
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/siriusa51/webtty/audit"
+	"github.com/siriusa51/webtty/auth"
+	"github.com/siriusa51/webtty/ratelimit"
+	"github.com/siriusa51/webtty/recorder"
 	"github.com/siriusa51/webtty/session"
 	templates "github.com/siriusa51/webtty/templates"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"path"
+	"time"
 )
 
 type RouterConfig struct {
-	Host       string
-	Port       int
-	PrefixPath string
-	IndexFile  string
-	Workdir    string
-	Command    string
-	ExtraEnv   []string
+	Host           string
+	Port           int
+	PrefixPath     string
+	IndexFile      string
+	Workdir        string
+	Command        string
+	ExtraEnv       []string
+	AllowedSignals []string
+	AllowedEnv     []string
+	Clipboard      session.ClipboardPolicy
+	// Profiles are additional profiles besides the default one built from Workdir, Command and ExtraEnv.
+	Profiles []Profile
+	// Htpasswd enables authentication with its credentials when set.
+	Htpasswd *auth.Htpasswd
+	// JWT enables authentication with bearer tokens when set.
+	JWT *auth.JWTVerifier
+	// LoginTTL is how long a login on the login page lasts.
+	LoginTTL time.Duration
+	// TLS is true when the server is served over https.
+	TLS bool
+	// ClientCertAuth enables authentication with verified TLS client certificates.
+	ClientCertAuth bool
+	// AllowedOrigins are origin patterns besides the same origin that may open a websocket, e.g. https://*.example.com.
+	AllowedOrigins []string
+	// LegacySessions lets clients create sessions by connecting to the websocket with an id of their own.
+	LegacySessions bool
+	// ConnectLimit limits websocket upgrades per client address and user.
+	ConnectLimit ratelimit.Limit
+	// CreateLimit limits session creation per client address and user.
+	CreateLimit ratelimit.Limit
+	// APILimit limits the other REST calls, including login attempts, per client address and user.
+	// Requests with HTTP basic auth are limited per client address as well, before the password is checked.
+	APILimit ratelimit.Limit
+	// AllowedNets are the client addresses that may use the server, empty means every address.
+	AllowedNets []netip.Prefix
+	// DeniedNets are the client addresses that may not use the server, they win over AllowedNets.
+	DeniedNets []netip.Prefix
+	// TrustedProxies are the proxies whose X-Forwarded-For and X-Real-IP headers name the client address
+	// and whose X-Forwarded-Proto names the scheme it used.
+	TrustedProxies []netip.Prefix
+	// Audit receives the audit events of the sessions, nil disables auditing.
+	Audit audit.Sink
+	// Recordings keeps the recordings of the sessions, nil disables recording.
+	// Only asciicast recordings are listed and played.
+	Recordings *recorder.Store
+	// RecordAll records every session, otherwise only those of profiles with record enabled.
+	RecordAll bool
+	// RecordingAdmins are the users who may watch every recording, the others only watch their own.
+	RecordingAdmins []string
+	// InputLogDir is where the input typed into the sessions is logged, empty disables input logging.
+	InputLogDir string
 }
 
-func NewHandler(config RouterConfig, log *slog.Logger, mgr *session.SessionManager) http.Handler {
-	router := gin.Default()
+func NewHandler(config RouterConfig, log *slog.Logger, mgr *session.SessionManager) (http.Handler, error) {
+	router := gin.New()
 	//gin.SetMode(gin.ReleaseMode)
 
+	// the token is taken out of the query first, the logger writes the query to the log
+	router.Use(tokenFromQuery, gin.Logger(), gin.Recovery())
+
 	router.SetHTMLTemplate(templates.GetTemplate("*"))
 
-	ctrl := NewController(
-		ControllerConfig{Workdir: config.Workdir, Command: config.Command, ExtraEnv: config.ExtraEnv},
-		log, mgr,
-	)
+	// only trusted proxies may tell who the client is, by default nobody
+	proxies := make([]string, 0, len(config.TrustedProxies))
+	for _, prefix := range config.TrustedProxies {
+		proxies = append(proxies, prefix.String())
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		log.Error("failed to set trusted proxies", "error", err)
+	}
+
+	// before any route, so a rejected client learns nothing
+	router.Use((&ipFilter{
+		log:   log.With("module", "apis/ipfilter"),
+		allow: config.AllowedNets,
+		deny:  config.DeniedNets,
+	}).Middleware)
+
+	profiles := append([]Profile{{
+		Name:           DefaultProfile,
+		Workdir:        config.Workdir,
+		Command:        config.Command,
+		ExtraEnv:       config.ExtraEnv,
+		AllowedSignals: config.AllowedSignals,
+		AllowedEnv:     config.AllowedEnv,
+		Clipboard:      config.Clipboard,
+	}}, config.Profiles...)
+
+	ctrl := NewController(ControllerConfig{
+		PrefixPath:      config.PrefixPath,
+		Profiles:        profiles,
+		AllowedOrigins:  config.AllowedOrigins,
+		TrustedProxies:  config.TrustedProxies,
+		LegacySessions:  config.LegacySessions,
+		Audit:           config.Audit,
+		Recordings:      config.Recordings,
+		RecordAll:       config.RecordAll,
+		RecordingAdmins: config.RecordingAdmins,
+		InputLogDir:     config.InputLogDir,
+	}, log, mgr)
 	prefixPath := config.PrefixPath
 
+	limitLog := log.With("module", "apis/ratelimit")
+	connectLimit := newRateLimiter("connect", config.ConnectLimit, limitLog).Middleware
+	createLimit := newRateLimiter("create", config.CreateLimit, limitLog).Middleware
+	apiLimit := newRateLimiter("api", config.APILimit, limitLog).Middleware
+
+	// before anything else, a forged request must not even get to log in
+	router.Use(ctrl.origins.Middleware)
+
+	if config.Htpasswd != nil || config.JWT != nil || config.ClientCertAuth {
+		signer, err := auth.NewCookieSigner(config.LoginTTL)
+		if err != nil {
+			return nil, err
+		}
+
+		authn := &authenticator{
+			log:        log.With("module", "apis/auth"),
+			prefixPath: prefixPath,
+			htpasswd:   config.Htpasswd,
+			jwt:        config.JWT,
+			clientCert: config.ClientCertAuth,
+			signer:     signer,
+			upgrader:   ctrl.upgrader,
+			guesses:    newRateLimiter("basic auth", config.APILimit, limitLog),
+		}
+
+		router.Use(authn.Middleware)
+		if config.Htpasswd != nil {
+			router.GET(authn.loginPath(), authn.LoginPage)
+			router.POST(authn.loginPath(), apiLimit, authn.Login)
+			router.POST(path.Join(prefixPath, "/logout"), authn.Logout)
+		}
+	}
+
+	// after authentication, so only requests that get through carry a client secret
+	router.Use((&clientIdentifier{prefixPath: prefixPath}).Middleware)
+
 	router.GET(path.Join(prefixPath, "/"), func(context *gin.Context) {
 		if config.IndexFile != "" {
 			content, err := os.ReadFile(config.IndexFile)
@@ -60,13 +183,32 @@ func NewHandler(config RouterConfig, log *slog.Logger, mgr *session.SessionManag
 		c.Data(http.StatusOK, "image/x-icon", data)
 	})
 
-	router.Any(path.Join(prefixPath, "/remove_session"), ctrl.RemoveSession)
-	router.GET(path.Join(prefixPath, "/ws"), ctrl.Websocket)
+	router.POST(path.Join(prefixPath, "/remove_session"), apiLimit, ctrl.RemoveSession)
+	router.DELETE(path.Join(prefixPath, "/remove_session"), apiLimit, ctrl.RemoveSession)
+	router.GET(path.Join(prefixPath, "/sessions"), apiLimit, ctrl.ListSessions)
+	router.POST(path.Join(prefixPath, "/sessions"), createLimit, ctrl.CreateSession)
+	router.GET(path.Join(prefixPath, "/sessions/:sid/transcript"), apiLimit, ctrl.SessionTranscript)
+	router.GET(path.Join(prefixPath, "/sessions/:sid/screen"), apiLimit, ctrl.SessionScreen)
+	router.GET(path.Join(prefixPath, "/sessions/:sid/search"), apiLimit, ctrl.SessionSearch)
+	router.GET(path.Join(prefixPath, "/sessions/:sid/stream"), connectLimit, ctrl.StreamSession)
+	router.POST(path.Join(prefixPath, "/signal"), apiLimit, ctrl.SignalSession)
+	router.POST(path.Join(prefixPath, "/invite"), apiLimit, ctrl.InviteParticipant)
+	router.GET(path.Join(prefixPath, "/ws"), connectLimit, ctrl.Websocket)
+
+	if config.Recordings != nil {
+		router.GET(path.Join(prefixPath, "/recordings"), apiLimit, ctrl.ListRecordings)
+		router.GET(path.Join(prefixPath, "/recordings/:id"), apiLimit, ctrl.RecordingPlayer)
+		router.GET(path.Join(prefixPath, "/recordings/:id/cast"), apiLimit, ctrl.StreamRecording)
+	}
 
 	log.Info("command -> " + config.Command)
 	log.Info("workdir -> " + config.Workdir)
-	addr := fmt.Sprintf("http://%v:%v%v", config.Host, config.Port, prefixPath)
+	scheme := "http"
+	if config.TLS {
+		scheme = "https"
+	}
+	addr := fmt.Sprintf("%v://%v:%v%v", scheme, config.Host, config.Port, prefixPath)
 	log.Info("please visit " + addr)
 
-	return router
+	return router, nil
 }
@@ -1,16 +1,67 @@
 package apis
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
 )
 
+// closeTimeout is how long to wait for the close frame to be written.
+const closeTimeout = time.Second
+
 type JSONResponse map[string]any
 
+// wsConn serializes writes to a websocket connection, which supports only one concurrent writer.
+type wsConn struct {
+	*websocket.Conn
+	lock sync.Mutex
+}
+
+func (c *wsConn) WriteMessage(messageType int, data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
+}
+
 func writeJSONResponse(ctx *gin.Context, code int, obj any) {
 	ctx.JSON(code, obj)
 }
 
-func writeWebSocketJSONResponse(conn *websocket.Conn, obj any) {
-	conn.WriteJSON(obj)
+// writeWebSocketWarning sends a warning that does not close the connection.
+func writeWebSocketWarning(conn *wsConn, code ErrorCode, message string) error {
+	data, _ := json.Marshal(ErrorMessage{Code: code, Message: message})
+	return conn.WriteMessage(websocket.TextMessage, append([]byte{Warning}, data...))
+}
+
+// writeWebSocketError sends the error as a control message, then closes the connection with its close code.
+// Pending reads are given closeTimeout to receive the client's close reply.
+func writeWebSocketError(conn *wsConn, code ErrorCode, message string) {
+	data, _ := json.Marshal(ErrorMessage{Code: code, Message: message})
+	conn.WriteMessage(websocket.TextMessage, append([]byte{Error}, data...))
+
+	closeMessage := websocket.FormatCloseMessage(code.CloseCode(), string(code))
+	conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(closeTimeout))
+	conn.SetReadDeadline(time.Now().Add(closeTimeout))
+}
+
+// queryInt parses the integer query parameter name, def if it is missing.
+// It answers 400 and returns false if the value is not a number between lo and hi.
+func queryInt(ctx *gin.Context, name string, def, lo, hi int) (int, bool) {
+	value := ctx.Query(name)
+	if value == "" {
+		return def, true
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < lo || n > hi {
+		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": fmt.Sprintf("invalid %s, expected %d to %d", name, lo, hi)})
+		return 0, false
+	}
+
+	return n, true
 }
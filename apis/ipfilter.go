@@ -0,0 +1,105 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// ParsePrefixes parses CIDRs like 10.0.0.0/8, a single address is a prefix of its own.
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", value, err)
+			}
+
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", value, err)
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// ipFilter rejects clients by address, a denied address is rejected even if it is allowed as well.
+// Without allowed prefixes every address that is not denied gets through.
+type ipFilter struct {
+	log   *slog.Logger
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// Middleware rejects clients that may not use the server and records the client address for handlers
+// that only see the request, like the websocket origin check.
+func (f *ipFilter) Middleware(ctx *gin.Context) {
+	ip := ctx.ClientIP()
+	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), clientIPKey{}, ip))
+
+	if !f.allows(ip) {
+		f.log.Warn("rejected client address", "remote", ip, "path", ctx.Request.URL.Path)
+		writeJSONResponse(ctx, http.StatusForbidden, JSONResponse{"error": "address is not allowed", "code": ErrorForbidden})
+		ctx.Abort()
+		return
+	}
+
+	ctx.Next()
+}
+
+func (f *ipFilter) allows(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return len(f.allow) == 0 && len(f.deny) == 0
+	}
+
+	addr = addr.Unmap()
+	if containsAddr(f.deny, addr) {
+		return false
+	}
+
+	return len(f.allow) == 0 || containsAddr(f.allow, addr)
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the client address recorded by ipFilter, or the peer address of the request.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+
+	return r.RemoteAddr
+}
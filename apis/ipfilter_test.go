@@ -0,0 +1,77 @@
+package apis
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/netip"
+	"testing"
+)
+
+func TestParsePrefixes(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []string
+		wantErr bool
+	}{
+		{"cidrs", []string{"10.0.0.0/8", " 192.168.1.0/24 "}, []string{"10.0.0.0/8", "192.168.1.0/24"}, false},
+		{"single addresses", []string{"127.0.0.1", "::1"}, []string{"127.0.0.1/32", "::1/128"}, false},
+		{"host bits are masked", []string{"10.1.2.3/8"}, []string{"10.0.0.0/8"}, false},
+		{"empty values are skipped", []string{"", " ", "10.0.0.0/8"}, []string{"10.0.0.0/8"}, false},
+		{"none", nil, []string{}, false},
+		{"invalid address", []string{"10.0.0"}, nil, true},
+		{"host name", []string{"localhost"}, nil, true},
+		{"invalid cidr", []string{"10.0.0.0/33"}, nil, true},
+		{"invalid cidr address", []string{"10.0.0/8"}, nil, true},
+		{"missing bits", []string{"10.0.0.0/"}, nil, true},
+		{"one bad value", []string{"10.0.0.0/8", "bad"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run("test ParsePrefixes() "+tt.name, func(t *testing.T) {
+			prefixes, err := ParsePrefixes(tt.values)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, prefixes)
+				return
+			}
+
+			assert.NoError(t, err)
+			got := make([]string, 0, len(prefixes))
+			for _, prefix := range prefixes {
+				got = append(got, prefix.String())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestIpFilter_allows(t *testing.T) {
+	prefixes := func(values ...string) []netip.Prefix {
+		parsed, err := ParsePrefixes(values)
+		assert.NoError(t, err)
+		return parsed
+	}
+
+	tests := []struct {
+		name   string
+		filter ipFilter
+		ip     string
+		want   bool
+	}{
+		{"no rules", ipFilter{}, "192.0.2.1", true},
+		{"allowed", ipFilter{allow: prefixes("10.0.0.0/8")}, "10.1.2.3", true},
+		{"not allowed", ipFilter{allow: prefixes("10.0.0.0/8")}, "192.0.2.1", false},
+		{"denied", ipFilter{deny: prefixes("192.0.2.1")}, "192.0.2.1", false},
+		{"not denied", ipFilter{deny: prefixes("192.0.2.1")}, "192.0.2.2", true},
+		{"denied wins over allowed", ipFilter{allow: prefixes("10.0.0.0/8"), deny: prefixes("10.0.0.1")}, "10.0.0.1", false},
+		{"mapped address", ipFilter{allow: prefixes("10.0.0.0/8")}, "::ffff:10.0.0.1", true},
+		{"invalid address without rules", ipFilter{}, "unknown", true},
+		{"invalid address with rules", ipFilter{deny: prefixes("192.0.2.1")}, "unknown", false},
+	}
+
+	for _, tt := range tests {
+		t.Run("test allows() "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.allows(tt.ip))
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package apis
+
+import (
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// originChecker decides which origins may open a websocket or change state with a request.
+// Browsers send the Origin header with every websocket upgrade, so a page from another site can not
+// hijack the session of a logged-in user. Requests without it do not come from a browser and are allowed.
+type originChecker struct {
+	log *slog.Logger
+	// allowed are origin patterns besides the same origin, e.g. https://*.example.com, "*" allows any origin.
+	allowed []string
+	// proxies may tell the scheme the client used with X-Forwarded-Proto.
+	proxies []netip.Prefix
+}
+
+func newOriginChecker(allowed []string, proxies []netip.Prefix, log *slog.Logger) *originChecker {
+	patterns := make([]string, 0, len(allowed))
+	for _, pattern := range allowed {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, strings.ToLower(strings.TrimSuffix(pattern, "/")))
+		}
+	}
+
+	return &originChecker{log: log, allowed: patterns, proxies: proxies}
+}
+
+// Check returns true if the request may be upgraded, it is meant for websocket.Upgrader.CheckOrigin.
+func (o *originChecker) Check(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || o.allows(origin, r) {
+		return true
+	}
+
+	o.log.Warn("rejected websocket upgrade from foreign origin", "origin", origin, "host", r.Host, "remote", clientIP(r))
+	return false
+}
+
+// Middleware rejects state changing requests that a page of a foreign origin made on behalf of the browser.
+// Browsers send Origin with such requests, older ones at least Referer. Requests with neither are only
+// accepted when they carry no cookies, those come from clients that hold their credentials themselves.
+func (o *originChecker) Middleware(ctx *gin.Context) {
+	switch ctx.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		ctx.Next()
+		return
+	}
+
+	origin := ctx.GetHeader("Origin")
+	if origin == "" {
+		if referer, err := url.Parse(ctx.GetHeader("Referer")); err == nil && referer.Host != "" {
+			origin = referer.Scheme + "://" + referer.Host
+		}
+	}
+
+	if origin == "" && len(ctx.Request.Cookies()) == 0 || origin != "" && o.allows(origin, ctx.Request) {
+		ctx.Next()
+		return
+	}
+
+	o.log.Warn("rejected request from foreign origin", "method", ctx.Request.Method, "path", ctx.Request.URL.Path,
+		"origin", origin, "host", ctx.Request.Host, "remote", ctx.ClientIP())
+	writeJSONResponse(ctx, http.StatusForbidden, JSONResponse{"error": "cross-origin request is not allowed", "code": ErrorForbidden})
+	ctx.Abort()
+}
+
+// allows returns true if origin is the origin of the request or matches an allowed pattern.
+func (o *originChecker) allows(origin string, r *http.Request) bool {
+	if sameOrigin(origin, o.scheme(r), r.Host) {
+		return true
+	}
+
+	for _, pattern := range o.allowed {
+		if matched, _ := path.Match(pattern, strings.ToLower(origin)); matched || pattern == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scheme returns the scheme the client used, behind a trusted proxy the one it forwarded.
+func (o *originChecker) scheme(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	if proto = strings.ToLower(strings.TrimSpace(proto)); proto != "" && o.fromProxy(r) {
+		scheme = proto
+	}
+
+	return scheme
+}
+
+func (o *originChecker) fromProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(host)
+	return err == nil && containsAddr(o.proxies, addr.Unmap())
+}
+
+// sameOrigin returns true if origin has the scheme, host and port the request was made to,
+// a missing port is the default port of the scheme.
+func sameOrigin(origin string, scheme string, host string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	return strings.EqualFold(u.Scheme, scheme) && strings.EqualFold(hostPort(u.Host, u.Scheme), hostPort(host, scheme))
+}
+
+func hostPort(host string, scheme string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+
+	port := "80"
+	if strings.EqualFold(scheme, "https") {
+		port = "443"
+	}
+
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
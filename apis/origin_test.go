@@ -0,0 +1,167 @@
+package apis
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/siriusa51/webtty/session"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"testing"
+)
+
+func TestOriginChecker_Check(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name    string
+		allowed []string
+		url     string
+		tls     bool
+		remote  string
+		header  http.Header
+		want    bool
+	}{
+		{"no origin", nil, "http://example.com/ws", false, "", http.Header{}, true},
+		{"same origin", nil, "http://example.com/ws", false, "", http.Header{"Origin": {"http://example.com"}}, true},
+		{"same origin with port", nil, "http://example.com:8080/ws", false, "", http.Header{"Origin": {"http://example.com:8080"}}, true},
+		{"same origin default port", nil, "https://example.com:443/ws", true, "", http.Header{"Origin": {"https://example.com"}}, true},
+		{"other port", nil, "http://example.com:8080/ws", false, "", http.Header{"Origin": {"http://example.com:9090"}}, false},
+		{"other scheme", nil, "https://example.com/ws", true, "", http.Header{"Origin": {"http://example.com"}}, false},
+		{"https origin over http", nil, "http://example.com/ws", false, "", http.Header{"Origin": {"https://example.com"}}, false},
+		{"other host", nil, "http://example.com/ws", false, "", http.Header{"Origin": {"http://evil.com"}}, false},
+		{"invalid origin", nil, "http://example.com/ws", false, "", http.Header{"Origin": {"null"}}, false},
+		{"wildcard pattern", []string{"https://*.example.com"}, "http://webtty.local/ws", false, "",
+			http.Header{"Origin": {"https://app.Example.com"}}, true},
+		{"wildcard pattern other scheme", []string{"https://*.example.com"}, "http://webtty.local/ws", false, "",
+			http.Header{"Origin": {"http://app.example.com"}}, false},
+		{"wildcard pattern other domain", []string{"https://*.example.com"}, "http://webtty.local/ws", false, "",
+			http.Header{"Origin": {"https://example.com.evil.com"}}, false},
+		{"exact pattern with trailing slash", []string{" https://app.example.com/ "}, "http://webtty.local/ws", false, "",
+			http.Header{"Origin": {"https://app.example.com"}}, true},
+		{"any origin", []string{"*"}, "http://webtty.local/ws", false, "", http.Header{"Origin": {"https://evil.com"}}, true},
+		{"forwarded proto of a trusted proxy", nil, "http://example.com/ws", false, "10.0.0.1:1234",
+			http.Header{"Origin": {"https://example.com"}, "X-Forwarded-Proto": {"https"}}, true},
+		{"forwarded proto of an unknown proxy", nil, "http://example.com/ws", false, "192.0.2.1:1234",
+			http.Header{"Origin": {"https://example.com"}, "X-Forwarded-Proto": {"https"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run("test Check() "+tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			r.Header = tt.header
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.remote != "" {
+				r.RemoteAddr = tt.remote
+			}
+
+			assert.Equal(t, tt.want, newOriginChecker(tt.allowed, proxies, log).Check(r))
+		})
+	}
+}
+
+func TestOriginChecker_Middleware(t *testing.T) {
+	o := newOriginChecker(nil, nil, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})))
+
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		want   int
+	}{
+		{"read only", http.MethodGet, http.Header{"Origin": {"http://evil.com"}}, http.StatusOK},
+		{"same origin", http.MethodPost, http.Header{"Origin": {"http://example.com"}}, http.StatusOK},
+		{"foreign origin", http.MethodPost, http.Header{"Origin": {"http://evil.com"}}, http.StatusForbidden},
+		{"same referer", http.MethodPost, http.Header{"Referer": {"http://example.com/index.html"}}, http.StatusOK},
+		{"foreign referer", http.MethodPost, http.Header{"Referer": {"http://evil.com/index.html"}}, http.StatusForbidden},
+		{"no origin without cookies", http.MethodDelete, http.Header{}, http.StatusOK},
+		{"no origin with cookies", http.MethodDelete, http.Header{"Cookie": {"webtty_client=x"}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run("test Middleware() "+tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Request = httptest.NewRequest(tt.method, "http://example.com/remove_session", nil)
+			ctx.Request.Header = tt.header
+
+			o.Middleware(ctx)
+			assert.Equal(t, tt.want, recorder.Code)
+			assert.Equal(t, tt.want != http.StatusOK, ctx.IsAborted())
+		})
+	}
+}
+
+func TestNewHandler_crossOrigin(t *testing.T) {
+	mgr := session.NewSessionManager()
+	handler, err := NewHandler(RouterConfig{Command: "cat"}, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})), mgr)
+	assert.NoError(t, err)
+
+	serve := func(method string, target string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "http://example.com"+target, nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	// the browser creates a session from the page and keeps the client cookie
+	created := serve(http.MethodPost, "/sessions", http.Header{"Origin": {"http://example.com"}})
+	if !assert.Equal(t, http.StatusCreated, created.Code) {
+		return
+	}
+
+	var body struct {
+		Sid string `json:"sid"`
+	}
+	assert.NoError(t, json.Unmarshal(created.Body.Bytes(), &body))
+	cookie := created.Result().Cookies()[0]
+	cookies := http.Header{"Cookie": {cookie.Name + "=" + cookie.Value}}
+	with := func(header http.Header, name string, value string) http.Header {
+		header = header.Clone()
+		header.Set(name, value)
+		return header
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header http.Header
+		want   int
+	}{
+		{"foreign origin", http.MethodPost, "/remove_session?sid=" + body.Sid,
+			with(cookies, "Origin", "http://evil.com"), http.StatusForbidden},
+		{"foreign origin of another port", http.MethodDelete, "/remove_session?sid=" + body.Sid,
+			with(cookies, "Origin", "http://example.com:8080"), http.StatusForbidden},
+		{"foreign referer", http.MethodPost, "/remove_session?sid=" + body.Sid,
+			with(cookies, "Referer", "http://evil.com/index.html"), http.StatusForbidden},
+		{"cookies only", http.MethodPost, "/remove_session?sid=" + body.Sid, cookies, http.StatusForbidden},
+		{"foreign origin creating a session", http.MethodPost, "/sessions",
+			with(cookies, "Origin", "http://evil.com"), http.StatusForbidden},
+		{"removal with GET", http.MethodGet, "/remove_session?sid=" + body.Sid, cookies, http.StatusNotFound},
+		{"unknown sid", http.MethodPost, "/remove_session?sid=unknown",
+			with(cookies, "Origin", "http://example.com"), http.StatusNotFound},
+		{"unknown sid without cookies", http.MethodDelete, "/remove_session?sid=unknown", http.Header{}, http.StatusNotFound},
+		{"same origin", http.MethodPost, "/remove_session?sid=" + body.Sid,
+			with(cookies, "Origin", "http://example.com"), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run("test ServeHTTP() "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, serve(tt.method, tt.target, tt.header).Code)
+		})
+	}
+
+	assert.False(t, mgr.HasSession(body.Sid))
+}
@@ -0,0 +1,76 @@
+package apis
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"path"
+)
+
+const (
+	clientCookieName = "webtty_client"
+	clientKey        = "webtty/client"
+	// clientCookieMaxAge keeps the browser secret for a year, sessions rarely live that long.
+	clientCookieMaxAge = 365 * 24 * 60 * 60
+)
+
+// clientIdentifier gives every browser a random secret in a cookie.
+// Without authentication the secret is what ties a session to the browser that created it.
+type clientIdentifier struct {
+	prefixPath string
+}
+
+// Middleware issues the secret to browsers that do not have one yet and stores it in the context.
+func (ci *clientIdentifier) Middleware(ctx *gin.Context) {
+	secret, err := ctx.Cookie(clientCookieName)
+	if err != nil || len(secret) < 32 {
+		buff := make([]byte, 32)
+		if _, err := rand.Read(buff); err != nil {
+			writeJSONResponse(ctx, http.StatusInternalServerError, JSONResponse{"error": "failed to generate client secret"})
+			ctx.Abort()
+			return
+		}
+
+		secret = base64.RawURLEncoding.EncodeToString(buff)
+		ctx.SetSameSite(http.SameSiteLaxMode)
+		ctx.SetCookie(clientCookieName, secret, clientCookieMaxAge, path.Join(ci.prefixPath, "/"), "", ctx.Request.TLS != nil, true)
+	}
+
+	ctx.Set(clientKey, secret)
+	ctx.Next()
+}
+
+// callerFromContext returns who makes the request as recorded on the sessions it creates:
+// the authenticated user, otherwise a digest of the browser secret.
+func callerFromContext(ctx *gin.Context) string {
+	if identity, _ := identityFromContext(ctx); identity.User != "" {
+		return userCaller(identity.User)
+	}
+
+	secret := ctx.GetString(clientKey)
+	if secret == "" {
+		return ""
+	}
+
+	digest := sha256.Sum256([]byte(secret))
+	return "client:" + hex.EncodeToString(digest[:])
+}
+
+// userCaller returns the caller of an authenticated user.
+func userCaller(user string) string {
+	return "user:" + user
+}
+
+// upgradeHeader returns the response headers to send along with a websocket upgrade,
+// so a secret issued by the middleware reaches the browser.
+func upgradeHeader(ctx *gin.Context) http.Header {
+	header := http.Header{}
+	for _, cookie := range ctx.Writer.Header().Values("Set-Cookie") {
+		header.Add("Set-Cookie", cookie)
+	}
+
+	return header
+}
@@ -0,0 +1,124 @@
+package apis
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/siriusa51/webtty/session"
+	"os"
+	"strings"
+	"syscall"
+)
+
+const DefaultProfile = "default"
+
+// Profile describes how a session process is started and what clients may do with it.
+type Profile struct {
+	Name     string   `json:"name"`
+	Workdir  string   `json:"workdir"`
+	Command  string   `json:"command"`
+	ExtraEnv []string `json:"extra_env"`
+	// AllowedSignals lists the signals clients may send to the session, e.g. SIGINT.
+	AllowedSignals []string `json:"allowed_signals"`
+	// AllowedEnv lists the environment variables clients may set when they create a session.
+	AllowedEnv []string `json:"allowed_env"`
+	// Clipboard controls OSC 52 clipboard sequences emitted by the session.
+	Clipboard session.ClipboardPolicy `json:"clipboard"`
+	// Record records the sessions of the profile when a recording directory is configured.
+	Record bool `json:"record"`
+}
+
+// supportedSignals are the signals a client can ask to deliver to the session.
+var supportedSignals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTSTP": syscall.SIGTSTP,
+	"SIGCONT": syscall.SIGCONT,
+}
+
+// ParseSignal parses a signal name such as "SIGINT" or "int".
+func ParseSignal(name string) (syscall.Signal, string, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	sig, ok := supportedSignals[name]
+	if !ok {
+		return 0, "", fmt.Errorf("unsupported signal: %s", name)
+	}
+
+	return sig, name, nil
+}
+
+// SignalAllowed returns true if clients may send the signal to sessions of the profile.
+func (p Profile) SignalAllowed(name string) bool {
+	for _, allowed := range p.AllowedSignals {
+		if _, allowed, err := ParseSignal(allowed); err == nil && allowed == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EnvAllowed returns true if clients may set the environment variable in sessions of the profile.
+func (p Profile) EnvAllowed(name string) bool {
+	for _, allowed := range p.AllowedEnv {
+		if allowed == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateClipboardPolicy checks the clipboard policy of a profile.
+func ValidateClipboardPolicy(policy session.ClipboardPolicy) error {
+	switch policy.Mode {
+	case "", session.ClipboardAllow, session.ClipboardDeny, session.ClipboardWriteOnly:
+	default:
+		return fmt.Errorf("unknown clipboard mode: %s", policy.Mode)
+	}
+
+	if policy.MaxSize < 0 {
+		return fmt.Errorf("clipboard max size must not be negative")
+	}
+
+	return nil
+}
+
+// LoadProfiles loads a JSON list of profiles from file.
+func LoadProfiles(file string) ([]Profile, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile file: %w", err)
+	}
+
+	var profiles []Profile
+	if err := json.Unmarshal(content, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse profile file: %w", err)
+	}
+
+	for _, profile := range profiles {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("profile name is required")
+		}
+
+		if profile.Command == "" {
+			return nil, fmt.Errorf("command of profile %s is required", profile.Name)
+		}
+
+		if err := ValidateClipboardPolicy(profile.Clipboard); err != nil {
+			return nil, fmt.Errorf("invalid clipboard policy of profile %s: %w", profile.Name, err)
+		}
+
+		for _, name := range profile.AllowedSignals {
+			if _, _, err := ParseSignal(name); err != nil {
+				return nil, fmt.Errorf("invalid signal of profile %s: %w", profile.Name, err)
+			}
+		}
+	}
+
+	return profiles, nil
+}
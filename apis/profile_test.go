@@ -0,0 +1,52 @@
+package apis
+
+import (
+	"github.com/stretchr/testify/assert"
+	"syscall"
+	"testing"
+)
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		want     syscall.Signal
+		wantName string
+		wantErr  bool
+	}{
+		{"full name", "SIGINT", syscall.SIGINT, "SIGINT", false},
+		{"short name", "term", syscall.SIGTERM, "SIGTERM", false},
+		{"lower case full name", "sigquit", syscall.SIGQUIT, "SIGQUIT", false},
+		{"surrounding spaces", " SIGTSTP ", syscall.SIGTSTP, "SIGTSTP", false},
+		{"unsupported signal", "SIGKILL", 0, "", true},
+		{"unknown signal", "FOO", 0, "", true},
+		{"number", "9", 0, "", true},
+		{"empty", "", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run("test ParseSignal() "+tt.name, func(t *testing.T) {
+			sig, name, err := ParseSignal(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, sig)
+			assert.Equal(t, tt.wantName, name)
+		})
+	}
+}
+
+func TestProfile_SignalAllowed(t *testing.T) {
+	profile := Profile{AllowedSignals: []string{"int", "SIGTERM", "bogus"}}
+
+	t.Run("test SignalAllowed()", func(t *testing.T) {
+		assert.True(t, profile.SignalAllowed("SIGINT"))
+		assert.True(t, profile.SignalAllowed("SIGTERM"))
+		assert.False(t, profile.SignalAllowed("SIGQUIT"))
+		assert.False(t, profile.SignalAllowed("SIGBOGUS"))
+		assert.False(t, Profile{}.SignalAllowed("SIGINT"))
+	})
+}
@@ -0,0 +1,54 @@
+package apis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/siriusa51/webtty/ratelimit"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// rateLimiter rejects clients that exceed a limit. Every client address and every authenticated user
+// has a bucket of its own, a request must get a token from all buckets that apply to it.
+type rateLimiter struct {
+	log     *slog.Logger
+	name    string
+	limiter *ratelimit.Limiter
+}
+
+func newRateLimiter(name string, limit ratelimit.Limit, log *slog.Logger) *rateLimiter {
+	return &rateLimiter{
+		log:     log,
+		name:    name,
+		limiter: ratelimit.NewLimiter(limit),
+	}
+}
+
+// Middleware answers 429 with Retry-After when the client ran out of tokens.
+func (r *rateLimiter) Middleware(ctx *gin.Context) {
+	keys := []string{"ip:" + ctx.ClientIP()}
+	if identity, _ := identityFromContext(ctx); identity.User != "" {
+		keys = append(keys, userCaller(identity.User))
+	}
+
+	if !r.allow(ctx, keys...) {
+		ctx.Abort()
+		return
+	}
+
+	ctx.Next()
+}
+
+// allow takes a token from the buckets of all keys, or answers 429 with Retry-After and returns false.
+// No bucket loses a token when one of them is empty.
+func (r *rateLimiter) allow(ctx *gin.Context, keys ...string) bool {
+	if ok, wait := r.limiter.Allow(keys...); !ok {
+		r.log.Warn("rate limit exceeded", "limit", r.name, "keys", keys, "path", ctx.Request.URL.Path)
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeJSONResponse(ctx, http.StatusTooManyRequests, JSONResponse{"error": "too many requests", "code": ErrorRateLimited})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,39 @@
+package apis
+
+import (
+	"github.com/siriusa51/webtty/auth"
+	"github.com/siriusa51/webtty/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	limiter := newRateLimiter("api", ratelimit.Limit{Rate: 0.001, Burst: 2}, slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{})))
+
+	request := func(user string, addr string) int {
+		ctx, recorder := newTestContext(auth.Identity{User: user}, "")
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/sessions", nil)
+		ctx.Request.RemoteAddr = addr + ":1234"
+		limiter.Middleware(ctx)
+		if !ctx.IsAborted() {
+			ctx.Status(http.StatusOK)
+		}
+		return recorder.Code
+	}
+
+	t.Run("test Middleware()", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request("alice", "192.0.2.1"))
+		assert.Equal(t, http.StatusOK, request("alice", "192.0.2.1"))
+		assert.Equal(t, http.StatusTooManyRequests, request("alice", "192.0.2.1"))
+	})
+
+	t.Run("test Middleware() rejected user keeps the address token", func(t *testing.T) {
+		assert.Equal(t, http.StatusTooManyRequests, request("alice", "192.0.2.2"))
+		assert.Equal(t, http.StatusOK, request("bob", "192.0.2.2"))
+		assert.Equal(t, http.StatusOK, request("bob", "192.0.2.2"))
+	})
+}
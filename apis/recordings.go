@@ -0,0 +1,221 @@
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/siriusa51/webtty/recorder"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+)
+
+const (
+	// maxSkippedOutput is the most output of the skipped part of a recording sent in one event when seeking.
+	maxSkippedOutput = 64 << 10
+	// streamFlushEvents is after how many events a recording stream is flushed to the client.
+	streamFlushEvents = 64
+)
+
+// ListRecordings lists the recordings the client may watch.
+func (c *Controller) ListRecordings(ctx *gin.Context) {
+	infos, err := recorder.List(c.config.Recordings.Dir())
+	if err != nil {
+		c.log.Error("failed to list recordings", "error", err)
+		writeJSONResponse(ctx, http.StatusInternalServerError, JSONResponse{"error": err.Error()})
+		return
+	}
+
+	allowed := make([]recorder.Info, 0, len(infos))
+	for _, info := range infos {
+		if c.mayWatch(ctx, info) {
+			allowed = append(allowed, info)
+		}
+	}
+
+	writeJSONResponse(ctx, http.StatusOK, JSONResponse{"recordings": allowed})
+}
+
+// RecordingPlayer serves the page that plays a recording.
+func (c *Controller) RecordingPlayer(ctx *gin.Context) {
+	info, ok := c.recording(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.HTML(http.StatusOK, "player.html", gin.H{
+		"prefix_path": path.Join(c.config.PrefixPath, "/"),
+		"id":          info.Id,
+		"cast_path":   path.Join(c.config.PrefixPath, "/recordings", info.Id, "cast"),
+		"user":        info.User,
+		"sid":         info.Sid,
+		"start":       info.Start.Format("2006-01-02 15:04:05 MST"),
+		"duration":    info.Duration,
+		"width":       info.Width,
+		"height":      info.Height,
+	})
+}
+
+// StreamRecording streams a recording as asciicast lines, starting at the from query parameter in seconds.
+// The output before from is sent in a few events at time from, so the player can seek without the client
+// loading the whole recording.
+func (c *Controller) StreamRecording(ctx *gin.Context) {
+	info, ok := c.recording(ctx)
+	if !ok {
+		return
+	}
+
+	from := 0.0
+	if value := ctx.Query("from"); value != "" {
+		var err error
+		if from, err = strconv.ParseFloat(value, 64); err != nil || from < 0 {
+			writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "invalid from"})
+			return
+		}
+	}
+
+	file, err := recorder.Open(c.config.Recordings.Dir(), info.User, info.Id)
+	if err != nil {
+		writeJSONResponse(ctx, http.StatusInternalServerError, JSONResponse{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	reader, err := recorder.NewAsciicastReader(file)
+	if err != nil {
+		writeJSONResponse(ctx, http.StatusInternalServerError, JSONResponse{"error": err.Error()})
+		return
+	}
+
+	ctx.Header("Content-Type", "application/x-asciicast")
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(ctx.Writer)
+	header := reader.Header()
+	if err := encoder.Encode(JSONResponse{"version": 2, "width": header.Width, "height": header.Height, "timestamp": header.Timestamp.Unix()}); err != nil {
+		return
+	}
+
+	var skipped []byte
+	flushSkipped := func() error {
+		if len(skipped) == 0 {
+			return nil
+		}
+
+		err := encoder.Encode(recorder.Event{Time: from, Code: "o", Data: string(skipped)})
+		skipped = skipped[:0]
+		return err
+	}
+
+	for count := 1; ; count++ {
+		event, err := reader.Next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.log.Warn("failed to read recording", "id", info.Id, "error", err)
+			}
+			break
+		}
+
+		if event.Time < from {
+			switch event.Code {
+			case "o":
+				skipped = append(skipped, event.Data...)
+				if len(skipped) < maxSkippedOutput {
+					continue
+				}
+				err = flushSkipped()
+			case "r":
+				if err = flushSkipped(); err == nil {
+					err = encoder.Encode(recorder.Event{Time: from, Code: event.Code, Data: event.Data})
+				}
+			default:
+				continue
+			}
+		} else {
+			if err = flushSkipped(); err == nil {
+				err = encoder.Encode(event)
+			}
+		}
+
+		if err != nil {
+			// the client went away, e.g. because it seeks
+			return
+		}
+
+		if count%streamFlushEvents == 0 {
+			ctx.Writer.Flush()
+		}
+	}
+
+	flushSkipped()
+	ctx.Writer.Flush()
+}
+
+// recordingWarning tells clients that a session is not recorded without revealing details of the server.
+func recordingWarning(err error) string {
+	if errors.Is(err, recorder.ErrDiskFull) {
+		return "the session is not recorded, the recording disk is nearly full"
+	}
+
+	return "the session is not recorded, the recording failed"
+}
+
+// recording returns the recording of the id parameter, or answers the request if it can not be watched.
+// The recording admins find the recordings of others by the user query parameter, empty for nobody.
+func (c *Controller) recording(ctx *gin.Context) (recorder.Info, bool) {
+	owner := recordingOwner(ctx)
+	if user, ok := ctx.GetQuery("user"); ok && c.isRecordingAdmin(ctx) {
+		owner = user
+	}
+
+	info, err := recorder.Stat(c.config.Recordings.Dir(), owner, ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, recorder.ErrRecordingNotFound) {
+			writeJSONResponse(ctx, http.StatusNotFound, JSONResponse{"error": err.Error()})
+		} else {
+			writeJSONResponse(ctx, http.StatusInternalServerError, JSONResponse{"error": err.Error()})
+		}
+		return recorder.Info{}, false
+	}
+
+	if !c.mayWatch(ctx, info) {
+		writeJSONResponse(ctx, http.StatusForbidden, JSONResponse{"error": "recording is not allowed"})
+		return recorder.Info{}, false
+	}
+
+	return info, true
+}
+
+// mayWatch returns true if the client may watch the recording: the recordings it owns,
+// or every recording for the recording admins. The profile of the recording must be allowed either way.
+func (c *Controller) mayWatch(ctx *gin.Context, info recorder.Info) bool {
+	identity, _ := identityFromContext(ctx)
+	if !identity.AllowsProfile(info.Profile) {
+		return false
+	}
+
+	if c.isRecordingAdmin(ctx) {
+		return true
+	}
+
+	return info.User != "" && info.User == recordingOwner(ctx)
+}
+
+// isRecordingAdmin returns true if the client is an authenticated user who may watch every recording.
+func (c *Controller) isRecordingAdmin(ctx *gin.Context) bool {
+	identity, _ := identityFromContext(ctx)
+	return identity.User != "" && slices.Contains(c.config.RecordingAdmins, identity.User)
+}
+
+// recordingOwner returns who the recordings of the sessions the request creates belong to:
+// the authenticated user, otherwise the caller of the browser.
+func recordingOwner(ctx *gin.Context) string {
+	if identity, _ := identityFromContext(ctx); identity.User != "" {
+		return identity.User
+	}
+
+	return callerFromContext(ctx)
+}
@@ -0,0 +1,93 @@
+package apis
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/siriusa51/webtty/auth"
+	"github.com/siriusa51/webtty/recorder"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestController_mayWatch(t *testing.T) {
+	ctrl := &Controller{config: ControllerConfig{RecordingAdmins: []string{"root"}}}
+
+	newContext := func(identity auth.Identity, secret string) *gin.Context {
+		ctx, _ := newTestContext(identity, secret)
+		return ctx
+	}
+
+	alice := newContext(auth.Identity{User: "alice"}, "")
+	browser := newContext(auth.Identity{}, "secret")
+
+	tests := []struct {
+		name string
+		ctx  *gin.Context
+		info recorder.Info
+		want bool
+	}{
+		{"own recording", alice, recorder.Info{User: "alice"}, true},
+		{"recording of another user", alice, recorder.Info{User: "bob"}, false},
+		{"recording nobody owns", alice, recorder.Info{}, false},
+		{"admin", newContext(auth.Identity{User: "root"}, ""), recorder.Info{User: "bob"}, true},
+		{"admin without the profile", newContext(auth.Identity{User: "root", Profiles: []string{}}, ""), recorder.Info{User: "bob"}, false},
+		{"own profile not allowed", newContext(auth.Identity{User: "alice", Profiles: []string{"ops"}}, ""), recorder.Info{User: "alice", Profile: "default"}, false},
+		{"recording of the browser", browser, recorder.Info{User: recordingOwner(browser)}, true},
+		{"recording of another browser", browser, recorder.Info{User: recordingOwner(newContext(auth.Identity{}, "other"))}, false},
+		{"anonymous recording nobody owns", browser, recorder.Info{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run("test mayWatch() "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ctrl.mayWatch(tt.ctx, tt.info))
+		})
+	}
+}
+
+func TestController_recording(t *testing.T) {
+	store := recorder.NewStore(t.TempDir(), slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{})))
+	ctrl := &Controller{config: ControllerConfig{Recordings: store, RecordingAdmins: []string{"root"}}}
+
+	// both users recorded a session with the same sid
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, owner := range []string{"alice", "bob"} {
+		rec, err := store.Create("abc", owner, DefaultProfile, recorder.Header{Timestamp: start, Title: owner})
+		assert.NoError(t, err)
+		assert.NoError(t, rec.Close())
+	}
+
+	tests := []struct {
+		name     string
+		identity auth.Identity
+		query    string
+		want     int
+		title    string
+	}{
+		{"own recording", auth.Identity{User: "bob"}, "", http.StatusOK, "bob"},
+		{"user query of another user", auth.Identity{User: "alice"}, "?user=bob", http.StatusOK, "alice"},
+		{"no recording", auth.Identity{User: "mallory"}, "?user=bob", http.StatusNotFound, ""},
+		{"admin", auth.Identity{User: "root"}, "?user=bob", http.StatusOK, "bob"},
+		{"profile not allowed", auth.Identity{User: "bob", Profiles: []string{"ops"}}, "", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run("test recording() "+tt.name, func(t *testing.T) {
+			ctx, response := newTestContext(tt.identity, "")
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/recordings/abc-20240501T100000Z"+tt.query, nil)
+			ctx.Params = gin.Params{{Key: "id", Value: "abc-20240501T100000Z"}}
+
+			info, ok := ctrl.recording(ctx)
+			assert.Equal(t, tt.want == http.StatusOK, ok)
+			if ok {
+				assert.Equal(t, tt.title, info.Title)
+				assert.Equal(t, DefaultProfile, info.Profile)
+			} else {
+				assert.Equal(t, tt.want, response.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package apis
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/siriusa51/webtty/audit"
+	"github.com/siriusa51/webtty/session"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// streamKeepalive is how often an idle output stream sends a comment, so proxies do not close it.
+var streamKeepalive = 15 * time.Second
+
+// StreamSession streams the output of the session as server-sent events, for clients that cannot open a websocket.
+// It never writes to the session and does not occupy it, so it can watch a session somebody is attached to.
+//
+// Every output event carries the offset just past its output as id, a reconnecting EventSource sends it back
+// in Last-Event-ID and continues where it stopped. Without an offset the stream starts with a repaint of
+// the current screen. encoding=raw sends the output as text instead of base64.
+func (c *Controller) StreamSession(ctx *gin.Context) {
+	sid := ctx.Param("sid")
+	sess, ok := c.authorizedSession(ctx, sid)
+	if !ok {
+		return
+	}
+
+	raw := false
+	switch ctx.DefaultQuery("encoding", "base64") {
+	case "base64":
+	case "raw":
+		raw = true
+	default:
+		writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "invalid encoding, expected base64 or raw"})
+		return
+	}
+
+	// offset is where the client's output ends, -1 starts with a repaint
+	offset := int64(-1)
+	value := ctx.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = ctx.Query("offset")
+	}
+	if value != "" {
+		var err error
+		if offset, err = strconv.ParseInt(value, 10, 64); err != nil || offset < 0 {
+			writeJSONResponse(ctx, http.StatusBadRequest, JSONResponse{"error": "invalid offset"})
+			return
+		}
+	}
+
+	log := c.log.With("sid", sid)
+	log.Info("output stream started", "offset", offset)
+	defer func() { log.Info("output stream stopped") }()
+
+	trail := c.auditor(ctx)
+	trail.Record(audit.EventAttach, sess)
+	defer trail.Record(audit.EventDetach, sess)
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-store")
+	// nginx buffers responses unless told otherwise
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	runCtx := ctx.Request.Context()
+	if identity, _ := identityFromContext(ctx); !identity.Expiry.IsZero() {
+		// the stream must not outlive the credentials it was opened with
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithDeadline(runCtx, identity.Expiry)
+		defer cancel()
+	}
+
+	stream := &eventStream{w: ctx.Writer, raw: raw}
+	err := stream.run(runCtx, sess, offset)
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		log.Info("credentials expired")
+		err = stream.write("closed", "", []string{"credentials expired"})
+	}
+
+	if err != nil {
+		log.Info("output stream closed", "reason", err)
+	}
+}
+
+// eventStream writes session output as server-sent events.
+type eventStream struct {
+	w   gin.ResponseWriter
+	raw bool
+	// pending is the start of a UTF-8 sequence that continues in the next output, raw events must be valid text
+	pending []byte
+}
+
+func (s *eventStream) run(ctx context.Context, sess *session.Session, offset int64) error {
+	if offset < 0 {
+		repaint := sess.Repaint()
+		if err := s.output("repaint", repaint.Offset, repaint.Data); err != nil {
+			return err
+		}
+		offset = repaint.Offset
+	}
+
+	for {
+		readCtx, cancel := context.WithTimeout(ctx, streamKeepalive)
+		chunk, err := sess.ReadOutput(readCtx, offset, maxOutputFrameSize)
+		cancel()
+
+		switch {
+		case errors.Is(err, io.EOF):
+			return s.write("closed", "", []string{"session closed"})
+		case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+			if _, err := io.WriteString(s.w, ": keepalive\n\n"); err != nil {
+				return err
+			}
+			s.w.Flush()
+			continue
+		case err != nil:
+			return err
+		}
+
+		if chunk.Offset != offset {
+			gap, _ := json.Marshal(OutputGapMessage{From: offset, To: chunk.Offset})
+			if err := s.write("gap", "", []string{string(gap)}); err != nil {
+				return err
+			}
+			s.pending = nil
+		}
+
+		offset = chunk.Offset + int64(len(chunk.Data))
+		if len(chunk.Data) == 0 {
+			continue
+		}
+
+		if err := s.output("output", offset, chunk.Data); err != nil {
+			return err
+		}
+	}
+}
+
+// output writes an event with session output, end is the offset just past it.
+func (s *eventStream) output(event string, end int64, data []byte) error {
+	if !s.raw {
+		return s.write(event, strconv.FormatInt(end, 10), []string{base64.StdEncoding.EncodeToString(data)})
+	}
+
+	data = append(s.pending, data...)
+	s.pending = nil
+	if n := completeText(data); n < len(data) {
+		s.pending = append([]byte{}, data[n:]...)
+		data = data[:n]
+	}
+
+	// a reconnecting client gets the held back sequence again
+	id := strconv.FormatInt(end-int64(len(s.pending)), 10)
+
+	// a line break ends an event field, every line is a data field of its own and the client joins them with \n;
+	// carriage returns would end a field as well and are dropped
+	data = bytes.ReplaceAll(data, []byte("\r"), nil)
+	lines := bytes.Split(bytes.ToValidUTF8(data, []byte("�")), []byte("\n"))
+
+	fields := make([]string, len(lines))
+	for i, line := range lines {
+		fields[i] = string(line)
+	}
+
+	return s.write(event, id, fields)
+}
+
+// write writes an event with the data fields and flushes it to the client.
+func (s *eventStream) write(event, id string, data []string) error {
+	var buff bytes.Buffer
+	fmt.Fprintf(&buff, "event: %s\n", event)
+	if id != "" {
+		fmt.Fprintf(&buff, "id: %s\n", id)
+	}
+	for _, line := range data {
+		fmt.Fprintf(&buff, "data: %s\n", line)
+	}
+	buff.WriteByte('\n')
+
+	if _, err := s.w.Write(buff.Bytes()); err != nil {
+		return err
+	}
+
+	s.w.Flush()
+	return nil
+}
+
+// completeText returns how much of data is complete UTF-8 text, a sequence cut off at its end is not.
+func completeText(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return i
+			}
+			break
+		}
+	}
+
+	return len(data)
+}
@@ -0,0 +1,194 @@
+package apis
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/siriusa51/webtty/session"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipeSessionIO is a SessionIO whose output is written to a pipe by the test.
+type pipeSessionIO struct {
+	reader *io.PipeReader
+	writer *io.PipeWriter
+	done   chan struct{}
+}
+
+func newPipeSessionIO() *pipeSessionIO {
+	reader, writer := io.Pipe()
+	return &pipeSessionIO{reader: reader, writer: writer, done: make(chan struct{})}
+}
+
+func (p *pipeSessionIO) Read(buff []byte) (int, error)        { return p.reader.Read(buff) }
+func (p *pipeSessionIO) Write(buff []byte) (int, error)       { return len(buff), nil }
+func (p *pipeSessionIO) Done() <-chan struct{}                { return p.done }
+func (p *pipeSessionIO) ResizeWindow(width, height int) error { return nil }
+
+func (p *pipeSessionIO) Close() error {
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+	return p.writer.Close()
+}
+
+// newOutputSession returns a session that has written output and ended, with the history size given.
+func newOutputSession(t *testing.T, output string, optfs ...session.OptionFunc) *session.Session {
+	sio := newPipeSessionIO()
+	sess := session.NewSession("test", sio, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})), optfs...)
+
+	go func() {
+		sio.writer.Write([]byte(output))
+		sio.Close()
+	}()
+
+	// reading starts the session, the whole output is in once it reports the end
+	assert.Eventually(t, func() bool {
+		_, err := sess.ReadOutput(context.Background(), int64(len(output)), 0)
+		return err == io.EOF
+	}, time.Second, 10*time.Millisecond)
+
+	return sess
+}
+
+func newTestStream(raw bool) (*eventStream, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	return &eventStream{w: ctx.Writer, raw: raw}, recorder
+}
+
+func TestCompleteText(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want int
+	}{
+		{"empty", "", 0},
+		{"ascii", "abc", 3},
+		{"complete", "a世", 4},
+		{"cut after one byte", "a\xe4", 1},
+		{"cut after two bytes", "a\xe4\xb8", 1},
+		{"cut four byte sequence", "\xf0\x9f\x98", 0},
+		{"complete four byte sequence", "\xf0\x9f\x98\x80", 4},
+		{"invalid byte", "a\xff", 2},
+		{"stray continuation", "a\x96", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run("test completeText() "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, completeText([]byte(tt.data)))
+		})
+	}
+}
+
+func TestEventStream_output(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     bool
+		outputs []string
+		want    string
+	}{
+		{
+			"base64",
+			false,
+			[]string{"a\r\nb"},
+			"event: output\nid: 4\ndata: " + base64.StdEncoding.EncodeToString([]byte("a\r\nb")) + "\n\n",
+		},
+		{
+			"raw lines",
+			true,
+			[]string{"hello\r\nworld\r\n"},
+			"event: output\nid: 14\ndata: hello\ndata: world\ndata: \n\n",
+		},
+		{
+			"raw carriage returns",
+			true,
+			[]string{"50%\r100%"},
+			"event: output\nid: 8\ndata: 50%100%\n\n",
+		},
+		{
+			"raw split character",
+			true,
+			[]string{"a\xe4\xb8", "\x96b"},
+			"event: output\nid: 1\ndata: a\n\nevent: output\nid: 5\ndata: 世b\n\n",
+		},
+		{
+			"raw invalid text",
+			true,
+			[]string{"a\xffb"},
+			"event: output\nid: 3\ndata: a�b\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("test output() "+tt.name, func(t *testing.T) {
+			stream, recorder := newTestStream(tt.raw)
+
+			end := int64(0)
+			for _, output := range tt.outputs {
+				end += int64(len(output))
+				assert.NoError(t, stream.output("output", end, []byte(output)))
+			}
+
+			assert.Equal(t, tt.want, recorder.Body.String())
+		})
+	}
+}
+
+func TestEventStream_run(t *testing.T) {
+	t.Run("test run() repaint", func(t *testing.T) {
+		sess := newOutputSession(t, "hello\r\nworld")
+		stream, recorder := newTestStream(false)
+
+		assert.NoError(t, stream.run(context.Background(), sess, -1))
+
+		repaint := sess.Repaint()
+		assert.Equal(t, "event: repaint\nid: 12\ndata: "+base64.StdEncoding.EncodeToString(repaint.Data)+"\n\n"+
+			"event: closed\ndata: session closed\n\n", recorder.Body.String())
+	})
+
+	t.Run("test run() resume", func(t *testing.T) {
+		sess := newOutputSession(t, "hello\r\nworld")
+		stream, recorder := newTestStream(true)
+
+		assert.NoError(t, stream.run(context.Background(), sess, 7))
+		assert.Equal(t, "event: output\nid: 12\ndata: world\n\nevent: closed\ndata: session closed\n\n", recorder.Body.String())
+	})
+
+	t.Run("test run() gap", func(t *testing.T) {
+		sess := newOutputSession(t, "hello world", session.WithHistorySize(4))
+		stream, recorder := newTestStream(true)
+
+		assert.NoError(t, stream.run(context.Background(), sess, 2))
+		assert.Equal(t, "event: gap\ndata: {\"from\":2,\"to\":7}\n\n"+
+			"event: output\nid: 11\ndata: orld\n\n"+
+			"event: closed\ndata: session closed\n\n", recorder.Body.String())
+	})
+
+	t.Run("test run() keepalive", func(t *testing.T) {
+		keepalive := streamKeepalive
+		streamKeepalive = 20 * time.Millisecond
+		defer func() { streamKeepalive = keepalive }()
+
+		sio := newPipeSessionIO()
+		sess := session.NewSession("test", sio, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})))
+		defer sess.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		stream, recorder := newTestStream(false)
+		assert.ErrorIs(t, stream.run(ctx, sess, 0), context.DeadlineExceeded)
+		assert.True(t, strings.HasPrefix(recorder.Body.String(), ": keepalive\n\n"))
+		assert.NotContains(t, recorder.Body.String(), "event:")
+	})
+}
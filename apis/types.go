@@ -6,15 +6,117 @@ const (
 	// Notify that the browser size has been changed
 	ResizeTerminal = '2'
 	Ping           = '3'
+	// Ask the server to deliver a signal to the foreground process
+	Signal = '4'
 )
 
 const (
+	// Session output, formatted as <offset>:<base64 data>
 	Output = '1'
 	Pong   = '2'
 	Closed = '3'
+	// Notify that output between the two offsets is no longer retained and was skipped
+	OutputGap = '4'
+	// Notify why the connection is about to be closed, see ErrorMessage
+	Error = '5'
+	// Notify that the window title set by the session process has changed
+	WindowTitle = '6'
+	// Notify that the working directory reported by the session process has changed
+	WorkingDirectory = '7'
+	// Ask the client to set its clipboard, see ClipboardMessage
+	Clipboard = '8'
+	// Notify about a problem that does not close the connection, see ErrorMessage
+	Warning = '9'
+	// Replace the terminal content with the current screen of the session, formatted as <offset>:<base64 data>,
+	// the output that follows continues at offset
+	Repaint = 'A'
 )
 
 type ResizeMessage struct {
 	Width  int `json:"width"`
 	Height int `json:"height"`
 }
+
+type SignalMessage struct {
+	Signal string `json:"signal"`
+}
+
+type OutputGapMessage struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+type ClipboardMessage struct {
+	Selection string `json:"selection"`
+	// Data is the base64 encoded clipboard content
+	Data string `json:"data"`
+}
+
+// CreateSessionRequest is the optional body of POST /sessions.
+type CreateSessionRequest struct {
+	Profile string `json:"profile"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	// Env are extra KEY=VALUE variables, only names the profile allows are accepted.
+	Env []string `json:"env"`
+}
+
+type SessionInfo struct {
+	Sid      string `json:"sid"`
+	Profile  string `json:"profile"`
+	Title    string `json:"title"`
+	Cwd      string `json:"cwd"`
+	Occupied bool   `json:"occupied"`
+}
+
+// ScreenResponse is what GET /sessions/:sid/screen?format=json returns.
+type ScreenResponse struct {
+	Width     int          `json:"width"`
+	Height    int          `json:"height"`
+	Title     string       `json:"title"`
+	AltScreen bool         `json:"alt_screen"`
+	Cursor    ScreenCursor `json:"cursor"`
+	Lines     []ScreenLine `json:"lines"`
+}
+
+type ScreenCursor struct {
+	X       int  `json:"x"`
+	Y       int  `json:"y"`
+	Visible bool `json:"visible"`
+}
+
+// ScreenLine is a row of the screen, as plain text and as runs of text in the same style.
+type ScreenLine struct {
+	Text  string       `json:"text"`
+	Spans []ScreenSpan `json:"spans"`
+}
+
+type ScreenSpan struct {
+	Text string `json:"text"`
+	// X is the column the span starts at
+	X int `json:"x"`
+	// Fg and Bg are CSS colors, empty for the default colors
+	Fg    string   `json:"fg,omitempty"`
+	Bg    string   `json:"bg,omitempty"`
+	Attrs []string `json:"attrs,omitempty"`
+}
+
+// SearchResponse is what GET /sessions/:sid/search returns.
+type SearchResponse struct {
+	Query string `json:"query"`
+	Regex bool   `json:"regex"`
+	// Start and End are the offsets of the output that was searched
+	Start   int64         `json:"start"`
+	End     int64         `json:"end"`
+	Matches []SearchMatch `json:"matches"`
+	// Truncated tells that more lines matched than the limit, only the newest ones are returned
+	Truncated bool `json:"truncated"`
+}
+
+type SearchMatch struct {
+	// Offset is the output offset of the start of the line
+	Offset int64    `json:"offset"`
+	Line   string   `json:"line"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+}
@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"time"
+)
+
+type EventType string
+
+const (
+	EventCreate EventType = "create"
+	EventAttach EventType = "attach"
+	EventDetach EventType = "detach"
+	EventResize EventType = "resize"
+	EventRemove EventType = "remove"
+	EventExit   EventType = "exit"
+)
+
+// Event is an entry of the audit trail.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    EventType `json:"event"`
+	Sid     string    `json:"sid"`
+	User    string    `json:"user,omitempty"`
+	Remote  string    `json:"remote,omitempty"`
+	Profile string    `json:"profile,omitempty"`
+	Command string    `json:"command,omitempty"`
+	Width   int       `json:"width,omitempty"`
+	Height  int       `json:"height,omitempty"`
+	// ExitStatus is the exit code of the session process, -1 if it was killed by a signal.
+	ExitStatus *int `json:"exit_status,omitempty"`
+}
+
+// Sink receives the audit events, implementations must be safe for concurrent use.
+type Sink interface {
+	Write(event Event) error
+	Close() error
+}
+
+type discard struct{}
+
+func (discard) Write(Event) error { return nil }
+func (discard) Close() error      { return nil }
+
+// Discard drops every event, it is used when auditing is disabled.
+var Discard Sink = discard{}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileSink appends the events as JSON lines to a file.
+// When the file would grow beyond maxSize it is rotated: file becomes file.1, file.1 becomes file.2 and so on,
+// the oldest beyond maxBackups is removed.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFileSink opens path for appending, a maxSize of 0 never rotates.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// Write appends the event as a single line.
+func (s *FileSink) Write(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	s.file = nil
+
+	if s.maxBackups > 0 {
+		os.Remove(s.backup(s.maxBackups))
+		for i := s.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(s.backup(i), s.backup(i+1)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to rotate audit log: %w", err)
+			}
+		}
+
+		if err := os.Rename(s.path, s.backup(1)); err != nil {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+
+	return s.open()
+}
+
+func (s *FileSink) backup(i int) string {
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
+
+// Close closes the file, later writes fail.
+func (s *FileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readEvents(t *testing.T, path string) []Event {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func TestFileSink(t *testing.T) {
+	t.Run("test Write()", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		sink, err := NewFileSink(path, 0, 0)
+		assert.NoError(t, err)
+
+		status := 1
+		assert.NoError(t, sink.Write(Event{Time: time.Unix(1, 0), Type: EventCreate, Sid: "a", User: "alice"}))
+		assert.NoError(t, sink.Write(Event{Time: time.Unix(2, 0), Type: EventExit, Sid: "a", ExitStatus: &status}))
+		assert.NoError(t, sink.Close())
+		assert.Error(t, sink.Write(Event{Type: EventCreate}))
+
+		events := readEvents(t, path)
+		assert.Len(t, events, 2)
+		assert.Equal(t, EventCreate, events[0].Type)
+		assert.Equal(t, "alice", events[0].User)
+		assert.Equal(t, 1, *events[1].ExitStatus)
+
+		// reopening appends
+		sink, err = NewFileSink(path, 0, 0)
+		assert.NoError(t, err)
+		assert.NoError(t, sink.Write(Event{Type: EventRemove, Sid: "a"}))
+		assert.NoError(t, sink.Close())
+		assert.Len(t, readEvents(t, path), 3)
+	})
+
+	t.Run("test rotate", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		line, _ := json.Marshal(Event{Type: EventAttach, Sid: "a"})
+
+		sink, err := NewFileSink(path, int64(len(line)+1)*2, 2)
+		assert.NoError(t, err)
+
+		for i := 0; i < 7; i++ {
+			assert.NoError(t, sink.Write(Event{Type: EventAttach, Sid: "a"}))
+		}
+		assert.NoError(t, sink.Close())
+
+		assert.Len(t, readEvents(t, path), 1)
+		assert.Len(t, readEvents(t, path+".1"), 2)
+		assert.Len(t, readEvents(t, path+".2"), 2)
+		assert.NoFileExists(t, path+".3")
+	})
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCookieSigner(t *testing.T) {
+	t.Run("test Sign()/Verify()", func(t *testing.T) {
+		signer, err := NewCookieSigner(time.Hour)
+		assert.NoError(t, err)
+		value := signer.Sign(Identity{User: "alice"})
+
+		identity, err := signer.Verify(value)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", identity.User)
+	})
+
+	t.Run("test tampered cookie", func(t *testing.T) {
+		signer, err := NewCookieSigner(time.Hour)
+		assert.NoError(t, err)
+		value := signer.Sign(Identity{User: "alice"})
+
+		_, err = signer.Verify("Ym9i" + value[len("YWxpY2U"):])
+		assert.Error(t, err)
+
+		other, err := NewCookieSigner(time.Hour)
+		assert.NoError(t, err)
+		_, err = other.Verify(value)
+		assert.Error(t, err)
+
+		_, err = signer.Verify("garbage")
+		assert.Error(t, err)
+	})
+
+	t.Run("test expired cookie", func(t *testing.T) {
+		signer, err := NewCookieSigner(-time.Second)
+		assert.NoError(t, err)
+		_, err = signer.Verify(signer.Sign(Identity{User: "alice"}))
+		assert.Error(t, err)
+	})
+}
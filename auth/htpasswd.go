@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"strings"
+)
+
+// Htpasswd holds credentials loaded from an htpasswd file.
+// Only bcrypt hashes are supported, create them with `htpasswd -B`.
+type Htpasswd struct {
+	users map[string][]byte
+	// dummy is compared for unknown users, so they take as long to verify as the known ones.
+	dummy []byte
+}
+
+// LoadHtpasswd loads the credentials from an htpasswd file.
+func LoadHtpasswd(file string) (*Htpasswd, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read htpasswd file: %w", err)
+	}
+
+	return ParseHtpasswd(content)
+}
+
+// ParseHtpasswd parses htpasswd content, one user:hash entry per line.
+func ParseHtpasswd(content []byte) (*Htpasswd, error) {
+	h := &Htpasswd{users: make(map[string][]byte)}
+	maxCost := bcrypt.DefaultCost
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(entry, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("invalid htpasswd entry at line %d", line)
+		}
+
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return nil, fmt.Errorf("unsupported hash of user %s at line %d, only bcrypt is supported", user, line)
+		}
+
+		if len(h.users) == 0 || cost > maxCost {
+			maxCost = cost
+		}
+
+		h.users[user] = []byte(hash)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse htpasswd: %w", err)
+	}
+
+	// the dummy has the cost of the hashes in the file, htpasswd -B uses a lower one than bcrypt by default
+	dummy, err := bcrypt.GenerateFromPassword([]byte("unknown user"), maxCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash dummy password: %w", err)
+	}
+	h.dummy = dummy
+
+	return h, nil
+}
+
+// Verify returns true if the password matches the one of the user.
+func (h *Htpasswd) Verify(user, password string) bool {
+	hash, exist := h.users[user]
+	if !exist {
+		bcrypt.CompareHashAndPassword(h.dummy, []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	t.Run("test LoadHtpasswd()", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "htpasswd")
+		content := "# comment\n\nalice:" + string(hash) + "\n"
+		assert.NoError(t, os.WriteFile(file, []byte(content), 0600))
+
+		h, err := LoadHtpasswd(file)
+		assert.NoError(t, err)
+		assert.True(t, h.Verify("alice", "secret"))
+		assert.False(t, h.Verify("alice", "wrong"))
+		assert.False(t, h.Verify("bob", "secret"))
+	})
+
+	t.Run("test Verify() unknown user", func(t *testing.T) {
+		h, err := ParseHtpasswd([]byte("alice:" + string(hash)))
+		assert.NoError(t, err)
+		assert.False(t, h.Verify("bob", "secret"))
+
+		// unknown users are compared against a hash as expensive as the ones of the file
+		cost, err := bcrypt.Cost(h.dummy)
+		assert.NoError(t, err)
+		assert.Equal(t, bcrypt.MinCost, cost)
+	})
+
+	t.Run("test htpasswd -B style hash", func(t *testing.T) {
+		// htpasswd writes $2y$ hashes
+		h, err := ParseHtpasswd([]byte("alice:$2y$" + string(hash[4:])))
+		assert.NoError(t, err)
+		assert.True(t, h.Verify("alice", "secret"))
+	})
+
+	t.Run("test unsupported hash", func(t *testing.T) {
+		_, err := ParseHtpasswd([]byte("alice:$apr1$salt$hash"))
+		assert.Error(t, err)
+
+		_, err = ParseHtpasswd([]byte("alice"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,27 @@
+package auth
+
+import "time"
+
+// Identity is the authenticated user of a request.
+type Identity struct {
+	User string
+	// Profiles the user may use, nil means every profile.
+	Profiles []string
+	// Expiry is when the credentials expire, zero means they do not.
+	Expiry time.Time
+}
+
+// AllowsProfile returns true if the user may use the profile.
+func (i Identity) AllowsProfile(profile string) bool {
+	if i.Profiles == nil {
+		return true
+	}
+
+	for _, allowed := range i.Profiles {
+		if allowed == profile {
+			return true
+		}
+	}
+
+	return false
+}
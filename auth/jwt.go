@@ -0,0 +1,388 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// jwtLeeway tolerates clock skew between the token issuer and the server.
+const jwtLeeway = 30 * time.Second
+
+var (
+	ErrTokenInvalid = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+var jwtHashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+// JWTVerifier verifies signed JWTs with an HMAC secret or the public keys of a JWKS.
+type JWTVerifier struct {
+	secret   []byte
+	keys     []jwk
+	issuer   string
+	audience string
+}
+
+type JWTOptionFunc func(*JWTVerifier)
+
+// WithJWTSecret accepts tokens signed with HS256, HS384 or HS512 and the secret.
+func WithJWTSecret(secret []byte) JWTOptionFunc {
+	return func(v *JWTVerifier) {
+		v.secret = secret
+	}
+}
+
+// WithJWTIssuer only accepts tokens with the iss claim.
+func WithJWTIssuer(issuer string) JWTOptionFunc {
+	return func(v *JWTVerifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithJWTAudience only accepts tokens whose aud claim contains audience.
+func WithJWTAudience(audience string) JWTOptionFunc {
+	return func(v *JWTVerifier) {
+		v.audience = audience
+	}
+}
+
+func NewJWTVerifier(optfs ...JWTOptionFunc) *JWTVerifier {
+	v := &JWTVerifier{}
+	for _, optf := range optfs {
+		optf(v)
+	}
+
+	return v
+}
+
+// LoadJWKS adds the keys of a local JWKS file, RSA, EC and oct keys are supported.
+func (v *JWTVerifier) LoadJWKS(file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read jwks file: %w", err)
+	}
+
+	keys, err := parseJWKS(content)
+	if err != nil {
+		return err
+	}
+
+	v.keys = append(v.keys, keys...)
+	return nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Sub      string          `json:"sub"`
+	Iss      string          `json:"iss"`
+	Aud      json.RawMessage `json:"aud"`
+	Exp      *int64          `json:"exp"`
+	Nbf      *int64          `json:"nbf"`
+	Profiles *[]string       `json:"profiles"`
+	Username string          `json:"preferred_username"`
+}
+
+// Verify checks the signature and claims of the token and returns its identity.
+// The user is taken from the sub (or preferred_username) claim and the allowed profiles from the profiles claim,
+// a token without the profiles claim may use every profile. The exp claim is required.
+func (v *JWTVerifier) Verify(token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, fmt.Errorf("%w: malformed token", ErrTokenInvalid)
+	}
+
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return Identity{}, fmt.Errorf("%w: malformed header: %w", ErrTokenInvalid, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: malformed signature: %w", ErrTokenInvalid, err)
+	}
+
+	if err := v.verifySignature(header, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return Identity{}, fmt.Errorf("%w: %w", ErrTokenInvalid, err)
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return Identity{}, fmt.Errorf("%w: malformed claims: %w", ErrTokenInvalid, err)
+	}
+
+	return v.verifyClaims(claims)
+}
+
+func (v *JWTVerifier) verifySignature(header jwtHeader, signed, signature []byte) error {
+	if len(header.Alg) != 5 {
+		return fmt.Errorf("unsupported algorithm: %s", header.Alg)
+	}
+
+	family, bits := header.Alg[:2], header.Alg[2:]
+	hash, ok := jwtHashes[bits]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm: %s", header.Alg)
+	}
+
+	if family == "HS" && v.secret != nil && verifyHMAC(hash, v.secret, signed, signature) == nil {
+		return nil
+	}
+
+	for _, key := range v.keys {
+		if header.Kid != "" && key.Kid != header.Kid {
+			continue
+		}
+
+		if key.Alg != "" && key.Alg != header.Alg {
+			continue
+		}
+
+		var err error
+		switch {
+		case family == "HS" && key.secret != nil:
+			err = verifyHMAC(hash, key.secret, signed, signature)
+		case family == "RS" && key.rsa != nil:
+			err = verifyRSA(hash, key.rsa, signed, signature)
+		case family == "ES" && key.ecdsa != nil:
+			err = verifyECDSA(hash, key.ecdsa, signed, signature)
+		default:
+			continue
+		}
+
+		if err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no key verifies the %s signature", header.Alg)
+}
+
+func (v *JWTVerifier) verifyClaims(claims jwtClaims) (Identity, error) {
+	now := time.Now()
+
+	if claims.Exp == nil {
+		return Identity{}, fmt.Errorf("%w: exp claim is required", ErrTokenInvalid)
+	}
+
+	expiry := time.Unix(*claims.Exp, 0)
+	if now.After(expiry.Add(jwtLeeway)) {
+		return Identity{}, ErrTokenExpired
+	}
+
+	if claims.Nbf != nil && now.Add(jwtLeeway).Before(time.Unix(*claims.Nbf, 0)) {
+		return Identity{}, fmt.Errorf("%w: token is not valid yet", ErrTokenInvalid)
+	}
+
+	if v.issuer != "" && claims.Iss != v.issuer {
+		return Identity{}, fmt.Errorf("%w: unexpected issuer %s", ErrTokenInvalid, claims.Iss)
+	}
+
+	if v.audience != "" && !audienceContains(claims.Aud, v.audience) {
+		return Identity{}, fmt.Errorf("%w: unexpected audience", ErrTokenInvalid)
+	}
+
+	user := claims.Sub
+	if user == "" {
+		user = claims.Username
+	}
+
+	if user == "" {
+		return Identity{}, fmt.Errorf("%w: sub claim is required", ErrTokenInvalid)
+	}
+
+	identity := Identity{User: user, Expiry: expiry}
+	if claims.Profiles != nil {
+		identity.Profiles = append([]string{}, *claims.Profiles...)
+	}
+
+	return identity, nil
+}
+
+// audienceContains checks the aud claim, which is either a string or a list of strings.
+func audienceContains(aud json.RawMessage, audience string) bool {
+	var single string
+	if err := json.Unmarshal(aud, &single); err == nil {
+		return single == audience
+	}
+
+	var list []string
+	if err := json.Unmarshal(aud, &list); err != nil {
+		return false
+	}
+
+	for _, value := range list {
+		if value == audience {
+			return true
+		}
+	}
+
+	return false
+}
+
+func decodeJWTPart(part string, obj any) error {
+	content, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(content, obj)
+}
+
+func verifyHMAC(hash crypto.Hash, secret, signed, signature []byte) error {
+	h := hmac.New(hash.New, secret)
+	h.Write(signed)
+	if !hmac.Equal(h.Sum(nil), signature) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+func verifyRSA(hash crypto.Hash, key *rsa.PublicKey, signed, signature []byte) error {
+	h := hash.New()
+	h.Write(signed)
+	return rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature)
+}
+
+func verifyECDSA(hash crypto.Hash, key *ecdsa.PublicKey, signed, signature []byte) error {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	if len(signature) != 2*size {
+		return fmt.Errorf("invalid signature length")
+	}
+
+	h := hash.New()
+	h.Write(signed)
+
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+	if !ecdsa.Verify(key, h.Sum(nil), r, s) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+// jwk is a key of a JWKS, only the fields needed for verification are kept.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+
+	secret []byte
+	rsa    *rsa.PublicKey
+	ecdsa  *ecdsa.PublicKey
+}
+
+var jwkCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func parseJWKS(content []byte) ([]jwk, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse jwks: %w", err)
+	}
+
+	keys := make([]jwk, 0, len(set.Keys))
+	for i, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		if err := key.parse(); err != nil {
+			return nil, fmt.Errorf("invalid key %d of jwks: %w", i, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) parse() error {
+	decode := func(value string) ([]byte, error) {
+		return base64.RawURLEncoding.DecodeString(value)
+	}
+
+	switch k.Kty {
+	case "oct":
+		secret, err := decode(k.K)
+		if err != nil || len(secret) == 0 {
+			return fmt.Errorf("invalid oct key")
+		}
+
+		k.secret = secret
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return fmt.Errorf("invalid modulus: %w", err)
+		}
+
+		e, err := decode(k.E)
+		if err != nil || len(e) > 4 {
+			return fmt.Errorf("invalid exponent")
+		}
+
+		k.rsa = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	case "EC":
+		curve, ok := jwkCurves[k.Crv]
+		if !ok {
+			return fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+
+		x, err := decode(k.X)
+		if err != nil {
+			return fmt.Errorf("invalid x: %w", err)
+		}
+
+		y, err := decode(k.Y)
+		if err != nil {
+			return fmt.Errorf("invalid y: %w", err)
+		}
+
+		k.ecdsa = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(k.ecdsa.X, k.ecdsa.Y) {
+			return fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+	default:
+		return fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+
+	return nil
+}
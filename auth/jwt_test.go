@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// signToken creates a JWT with the claims, sign returns the signature of the signing input.
+func signToken(t *testing.T, header, claims map[string]any, sign func([]byte) []byte) string {
+	encode := func(obj any) string {
+		content, err := json.Marshal(obj)
+		assert.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(content)
+	}
+
+	input := encode(header) + "." + encode(claims)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(input)))
+}
+
+func hmacSigner(secret []byte) func([]byte) []byte {
+	return func(input []byte) []byte {
+		h := hmac.New(sha256.New, secret)
+		h.Write(input)
+		return h.Sum(nil)
+	}
+}
+
+func TestJWTVerifier_Secret(t *testing.T) {
+	secret := []byte("secret")
+	verifier := NewJWTVerifier(WithJWTSecret(secret), WithJWTIssuer("portal"), WithJWTAudience("webtty"))
+	header := map[string]any{"alg": "HS256", "typ": "JWT"}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	t.Run("test valid token", func(t *testing.T) {
+		token := signToken(t, header, map[string]any{
+			"sub": "alice", "iss": "portal", "aud": []string{"webtty"}, "exp": exp, "profiles": []string{"default"},
+		}, hmacSigner(secret))
+
+		identity, err := verifier.Verify(token)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", identity.User)
+		assert.Equal(t, []string{"default"}, identity.Profiles)
+		assert.Equal(t, exp, identity.Expiry.Unix())
+		assert.True(t, identity.AllowsProfile("default"))
+		assert.False(t, identity.AllowsProfile("admin"))
+	})
+
+	t.Run("test token without profiles", func(t *testing.T) {
+		token := signToken(t, header, map[string]any{"sub": "alice", "iss": "portal", "aud": "webtty", "exp": exp}, hmacSigner(secret))
+
+		identity, err := verifier.Verify(token)
+		assert.NoError(t, err)
+		assert.Nil(t, identity.Profiles)
+		assert.True(t, identity.AllowsProfile("admin"))
+	})
+
+	t.Run("test invalid tokens", func(t *testing.T) {
+		claims := map[string]any{"sub": "alice", "iss": "portal", "aud": "webtty", "exp": exp}
+
+		_, err := verifier.Verify(signToken(t, header, claims, hmacSigner([]byte("wrong"))))
+		assert.ErrorIs(t, err, ErrTokenInvalid)
+
+		_, err = verifier.Verify(signToken(t, map[string]any{"alg": "none"}, claims, func([]byte) []byte { return nil }))
+		assert.ErrorIs(t, err, ErrTokenInvalid)
+
+		expired := map[string]any{"sub": "alice", "iss": "portal", "aud": "webtty", "exp": time.Now().Add(-time.Hour).Unix()}
+		_, err = verifier.Verify(signToken(t, header, expired, hmacSigner(secret)))
+		assert.ErrorIs(t, err, ErrTokenExpired)
+
+		noExp := map[string]any{"sub": "alice", "iss": "portal", "aud": "webtty"}
+		_, err = verifier.Verify(signToken(t, header, noExp, hmacSigner(secret)))
+		assert.ErrorIs(t, err, ErrTokenInvalid)
+
+		otherAudience := map[string]any{"sub": "alice", "iss": "portal", "aud": "other", "exp": exp}
+		_, err = verifier.Verify(signToken(t, header, otherAudience, hmacSigner(secret)))
+		assert.ErrorIs(t, err, ErrTokenInvalid)
+
+		_, err = verifier.Verify("not.a.token")
+		assert.ErrorIs(t, err, ErrTokenInvalid)
+	})
+}
+
+func TestJWTVerifier_JWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	encode := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	jwks := map[string]any{"keys": []map[string]any{
+		{"kty": "RSA", "kid": "rsa", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecKey.X.FillBytes(make([]byte, 32))), "y": encode(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}}
+
+	content, err := json.Marshal(jwks)
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(file, content, 0600))
+
+	verifier := NewJWTVerifier()
+	assert.NoError(t, verifier.LoadJWKS(file))
+
+	claims := map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+
+	t.Run("test RS256", func(t *testing.T) {
+		token := signToken(t, map[string]any{"alg": "RS256", "kid": "rsa"}, claims, func(input []byte) []byte {
+			hash := sha256.Sum256(input)
+			signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, hash[:])
+			assert.NoError(t, err)
+			return signature
+		})
+
+		identity, err := verifier.Verify(token)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", identity.User)
+	})
+
+	t.Run("test ES256", func(t *testing.T) {
+		token := signToken(t, map[string]any{"alg": "ES256", "kid": "ec"}, claims, func(input []byte) []byte {
+			hash := sha256.Sum256(input)
+			r, s, err := ecdsa.Sign(rand.Reader, ecKey, hash[:])
+			assert.NoError(t, err)
+			return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		})
+
+		identity, err := verifier.Verify(token)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", identity.User)
+	})
+
+	t.Run("test HS256 with public key", func(t *testing.T) {
+		// the public key must never be usable as an HMAC secret
+		token := signToken(t, map[string]any{"alg": "HS256", "kid": "rsa"}, claims, hmacSigner(rsaKey.N.Bytes()))
+
+		_, err := verifier.Verify(token)
+		assert.ErrorIs(t, err, ErrTokenInvalid)
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/siriusa51/webtty/recorder"
+	"os"
+)
+
+const (
+	defaultConvertWidth  = 80
+	defaultConvertHeight = 24
+)
+
+// convert runs the convert command, which converts a recording to another format, and returns the exit code.
+func convert(arguments []string) int {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	from := flags.String("from", "", "Format of the input: asciicast, ttyrec or script, guessed from the extension if not set")
+	to := flags.String("to", "", "Format of the output: asciicast, ttyrec or script, guessed from the extension if not set")
+	width := flags.Int("width", defaultConvertWidth, "Terminal width of the output if the input does not store it")
+	height := flags.Int("height", defaultConvertHeight, "Terminal height of the output if the input does not store it")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s convert [options] <input> <output>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "The timing file of a script recording is named like the typescript with the extension %s.\n", recorder.TimingExt)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(arguments); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := convertRecording(flags.Arg(0), *from, flags.Arg(1), *to, *width, *height); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func convertRecording(input string, from string, output string, to string, width int, height int) error {
+	inputFormat, err := recordingFormat(input, from)
+	if err != nil {
+		return err
+	}
+
+	outputFormat, err := recordingFormat(output, to)
+	if err != nil {
+		return err
+	}
+
+	reader, err := inputFormat.Open(input)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	header := reader.Header()
+	if header.Width == 0 || header.Height == 0 {
+		header.Width, header.Height = width, height
+	}
+
+	rec, err := outputFormat.Create(output, header)
+	if err != nil {
+		return err
+	}
+
+	if err := recorder.Convert(reader, rec); err != nil {
+		rec.Close()
+		return fmt.Errorf("failed to convert %s: %w", input, err)
+	}
+
+	return rec.Close()
+}
+
+// recordingFormat returns the format named name, or the format of the file at path if name is empty.
+func recordingFormat(path string, name string) (recorder.Format, error) {
+	if name != "" {
+		return recorder.FormatByName(name)
+	}
+
+	return recorder.FormatByPath(path)
+}
@@ -1,17 +1,57 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"github.com/siriusa51/waitprocess/v2"
 	"github.com/siriusa51/waitprocess/v2/ext/http_srv"
 	"github.com/siriusa51/webtty/apis"
+	"github.com/siriusa51/webtty/audit"
+	"github.com/siriusa51/webtty/auth"
+	"github.com/siriusa51/webtty/ratelimit"
+	"github.com/siriusa51/webtty/recorder"
 	"github.com/siriusa51/webtty/session"
+	"github.com/siriusa51/webtty/tlsutil"
 	"log/slog"
+	"net/http"
+	"net/netip"
 	"os"
+	"strings"
+	"time"
 )
 
+// httpsShutdownTimeout matches the shutdown timeout of http_srv.
+const httpsShutdownTimeout = 15 * time.Second
+
 type Args struct {
 	apis.RouterConfig
+	HistorySize       int
+	MaxSessions       int
+	ProfileFile       string
+	HtpasswdFile      string
+	JWTSecret         string
+	JWTJWKSFile       string
+	JWTIssuer         string
+	JWTAudience       string
+	TLSCert           string
+	TLSKey            string
+	TLSClientCA       string
+	ConnectRate       string
+	CreateRate        string
+	APIRate           string
+	AuditLog          string
+	AuditMaxSize      int
+	AuditBackups      int
+	RecordDir         string
+	RecordFormat      string
+	RecordCompress    bool
+	RecordMaxAge      time.Duration
+	RecordMaxSize     int
+	RecordMaxUserSize int
+	RecordMinFree     int
+	RecordOptions     []recorder.StoreOptionFunc
 }
 
 func ParseArgs() Args {
@@ -22,24 +62,252 @@ func ParseArgs() Args {
 	flag.StringVar(&args.IndexFile, "index-file", "", "Index file, if not set, use the default index.html")
 	flag.StringVar(&args.Workdir, "workdir", "", "Workdir for the command, default is current directory")
 	flag.StringVar(&args.Command, "command", "", "Command to run")
+	flag.Func("allow-signals", "Comma separated signals clients may send to the session, e.g. SIGINT,SIGTERM", func(value string) error {
+		for _, name := range strings.Split(value, ",") {
+			_, name, err := apis.ParseSignal(name)
+			if err != nil {
+				return err
+			}
+
+			args.AllowedSignals = append(args.AllowedSignals, name)
+		}
+
+		return nil
+	})
+	flag.Func("allow-env", "Comma separated environment variables clients may set when they create a session, e.g. LANG,TZ", func(value string) error {
+		args.AllowedEnv = append(args.AllowedEnv, strings.Split(value, ",")...)
+		return nil
+	})
+	flag.StringVar((*string)(&args.Clipboard.Mode), "clipboard", "allow", "OSC 52 clipboard policy: allow, deny or allow-write-only")
+	flag.IntVar(&args.Clipboard.MaxSize, "clipboard-max-size", 0, "Largest clipboard content in bytes the session may write, 0 means unlimited")
+	flag.BoolVar(&args.Clipboard.Forward, "clipboard-forward", false, "Forward clipboard writes to the page as separate messages instead of passing them to the terminal")
+	flag.StringVar(&args.ProfileFile, "profile-file", "", "JSON file with additional session profiles")
+	flag.StringVar(&args.HtpasswdFile, "htpasswd", "", "Htpasswd file with bcrypt hashed credentials, enables authentication when set")
+	flag.StringVar(&args.JWTSecret, "jwt-secret", os.Getenv("WEBTTY_JWT_SECRET"), "HMAC secret to verify JWT bearer tokens, default is $WEBTTY_JWT_SECRET")
+	flag.StringVar(&args.JWTJWKSFile, "jwt-jwks", "", "Local JWKS file with the keys to verify JWT bearer tokens")
+	flag.StringVar(&args.JWTIssuer, "jwt-issuer", "", "Only accept JWTs issued by this issuer")
+	flag.StringVar(&args.JWTAudience, "jwt-audience", "", "Only accept JWTs for this audience")
+	flag.DurationVar(&args.LoginTTL, "login-ttl", 24*time.Hour, "How long a login on the login page lasts")
+	flag.StringVar(&args.TLSCert, "tls-cert", "", "TLS certificate file, serves https when set together with -tls-key")
+	flag.StringVar(&args.TLSKey, "tls-key", "", "TLS private key file")
+	flag.StringVar(&args.TLSClientCA, "tls-client-ca", "", "CA bundle to verify client certificates, clients must present one when set")
+	flag.Func("allowed-origins", "Comma separated origins besides the same origin that may open a websocket, wildcards are supported, e.g. https://*.example.com", func(value string) error {
+		args.AllowedOrigins = append(args.AllowedOrigins, strings.Split(value, ",")...)
+		return nil
+	})
+	for _, list := range []struct {
+		name     string
+		usage    string
+		prefixes *[]netip.Prefix
+	}{
+		{"allow-ip", "Comma separated addresses or CIDRs of the clients that may use the server, default is every client", &args.AllowedNets},
+		{"deny-ip", "Comma separated addresses or CIDRs of the clients that may not use the server", &args.DeniedNets},
+		{"trusted-proxies", "Comma separated addresses or CIDRs of reverse proxies whose X-Forwarded-For, X-Real-IP and X-Forwarded-Proto headers are trusted", &args.TrustedProxies},
+	} {
+		flag.Func(list.name, list.usage, func(value string) error {
+			prefixes, err := apis.ParsePrefixes(strings.Split(value, ","))
+			if err != nil {
+				return err
+			}
+
+			*list.prefixes = append(*list.prefixes, prefixes...)
+			return nil
+		})
+	}
+	flag.BoolVar(&args.LegacySessions, "legacy-sessions", false, "Let clients create sessions by connecting to the websocket with a session id of their own")
+	flag.StringVar(&args.ConnectRate, "connect-rate", "30/m:10", "Websocket connects per client address and user, <count>/<s|m|h>[:burst], 0 disables the limit")
+	flag.StringVar(&args.CreateRate, "create-rate", "10/m:5", "Session creations per client address and user, <count>/<s|m|h>[:burst], 0 disables the limit")
+	flag.StringVar(&args.APIRate, "api-rate", "5/s:20", "Other REST calls and login attempts per client address and user, <count>/<s|m|h>[:burst], 0 disables the limit")
+	flag.StringVar(&args.AuditLog, "audit-log", "", "Append the session audit trail as JSON lines to this file")
+	flag.IntVar(&args.AuditMaxSize, "audit-log-max-size", 100, "Size in MB at which the audit log is rotated, 0 never rotates")
+	flag.IntVar(&args.AuditBackups, "audit-log-backups", 5, "Number of rotated audit logs to keep")
+	flag.StringVar(&args.RecordDir, "record-dir", "", "Directory for recordings of the sessions of profiles with record enabled")
+	flag.BoolVar(&args.RecordAll, "record", false, "Record every session, -record-dir is required")
+	flag.Func("recording-admins", "Comma separated users who may watch every recording, the others only watch their own", func(value string) error {
+		args.RecordingAdmins = append(args.RecordingAdmins, strings.Split(value, ",")...)
+		return nil
+	})
+	flag.StringVar(&args.RecordFormat, "record-format", "asciicast", "Format of the recordings: asciicast, ttyrec or script, only asciicast recordings can be played in the browser")
+	flag.BoolVar(&args.RecordCompress, "record-compress", false, "Gzip recordings once their session is done")
+	flag.DurationVar(&args.RecordMaxAge, "record-max-age", 0, "Remove recordings older than this, e.g. 720h, 0 keeps them")
+	flag.IntVar(&args.RecordMaxSize, "record-max-size", 0, "Size in MB all recordings may take, the oldest are removed beyond it, 0 means unlimited")
+	flag.IntVar(&args.RecordMaxUserSize, "record-max-user-size", 0, "Size in MB the recordings of one user may take, the oldest are removed beyond it, 0 means unlimited")
+	flag.IntVar(&args.RecordMinFree, "record-min-free", 512, "Free space in MB below which recording is disabled, 0 never disables it")
+	flag.StringVar(&args.InputLogDir, "input-log-dir", "", "Directory for logs of the input typed into the sessions, input is redacted while a password is read")
+	flag.IntVar(&args.MaxSessions, "max-sessions", 0, "Maximum number of concurrent sessions, 0 means unlimited")
+	flag.IntVar(&args.HistorySize, "history-size", 1<<20, "Bytes of recent output each session retains for reconnecting clients")
 	flag.Parse()
 
 	if args.Command == "" {
 		panic("command is required, please specify it with --command")
 	}
 
+	if err := apis.ValidateClipboardPolicy(args.Clipboard); err != nil {
+		panic(err)
+	}
+
+	if (args.TLSCert == "") != (args.TLSKey == "") {
+		panic("both -tls-cert and -tls-key are required to serve https")
+	}
+
+	if args.TLSClientCA != "" && args.TLSCert == "" {
+		panic("-tls-client-ca requires -tls-cert and -tls-key")
+	}
+
+	for _, rate := range []struct {
+		value string
+		limit *ratelimit.Limit
+	}{
+		{args.ConnectRate, &args.ConnectLimit},
+		{args.CreateRate, &args.CreateLimit},
+		{args.APIRate, &args.APILimit},
+	} {
+		limit, err := ratelimit.ParseLimit(rate.value)
+		if err != nil {
+			panic(err)
+		}
+
+		*rate.limit = limit
+	}
+
+	if args.RecordAll && args.RecordDir == "" {
+		panic("-record requires -record-dir")
+	}
+
+	format, err := recorder.FormatByName(args.RecordFormat)
+	if err != nil {
+		panic(err)
+	}
+
+	args.RecordOptions = []recorder.StoreOptionFunc{
+		recorder.WithFormat(format),
+		recorder.WithRetention(recorder.Retention{
+			MaxAge:      args.RecordMaxAge,
+			MaxSize:     int64(args.RecordMaxSize) << 20,
+			MaxUserSize: int64(args.RecordMaxUserSize) << 20,
+		}),
+		recorder.WithMinFreeSpace(uint64(args.RecordMinFree) << 20),
+	}
+	if args.RecordCompress {
+		args.RecordOptions = append(args.RecordOptions, recorder.WithCompression())
+	}
+
+	args.TLS = args.TLSCert != ""
+	args.ClientCertAuth = args.TLSClientCA != ""
+
+	if args.HtpasswdFile != "" {
+		htpasswd, err := auth.LoadHtpasswd(args.HtpasswdFile)
+		if err != nil {
+			panic(err)
+		}
+
+		args.Htpasswd = htpasswd
+	}
+
+	if args.JWTSecret != "" || args.JWTJWKSFile != "" {
+		optfs := []auth.JWTOptionFunc{auth.WithJWTIssuer(args.JWTIssuer), auth.WithJWTAudience(args.JWTAudience)}
+		if args.JWTSecret != "" {
+			optfs = append(optfs, auth.WithJWTSecret([]byte(args.JWTSecret)))
+		}
+
+		args.JWT = auth.NewJWTVerifier(optfs...)
+		if args.JWTJWKSFile != "" {
+			if err := args.JWT.LoadJWKS(args.JWTJWKSFile); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	if args.ProfileFile != "" {
+		profiles, err := apis.LoadProfiles(args.ProfileFile)
+		if err != nil {
+			panic(err)
+		}
+
+		args.Profiles = profiles
+	}
+
 	return args
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "convert" {
+		os.Exit(convert(os.Args[2:]))
+	}
+
 	args := ParseArgs()
-	mgr := session.NewSessionManager()
 	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
-	router := apis.NewHandler(args.RouterConfig, log, mgr)
 
-	if err := http_srv.RegisterHttpSrv(fmt.Sprintf("%s:%d", args.Host, args.Port), router).
-		RegisterSignal(os.Kill, os.Interrupt).
-		Run(); err != nil {
+	args.Audit = audit.Discard
+	if args.AuditLog != "" {
+		sink, err := audit.NewFileSink(args.AuditLog, int64(args.AuditMaxSize)<<20, args.AuditBackups)
+		if err != nil {
+			panic(err)
+		}
+
+		args.Audit = sink
+	}
+	defer args.Audit.Close()
+
+	if args.RecordDir != "" {
+		args.Recordings = recorder.NewStore(args.RecordDir, log.With("module", "recorder"), args.RecordOptions...)
+		waitprocess.RegisterProcess("recording_janitor", waitprocess.RunWithCtx(args.Recordings.Run))
+	}
+
+	mgr := session.NewSessionManager(
+		session.WithHistorySize(args.HistorySize),
+		session.WithMaxSessions(args.MaxSessions),
+		session.WithAuditSink(args.Audit),
+	)
+	router, err := apis.NewHandler(args.RouterConfig, log, mgr)
+	if err != nil {
+		panic(err)
+	}
+
+	addr := fmt.Sprintf("%s:%d", args.Host, args.Port)
+
+	var wp *waitprocess.WaitProcess
+	if args.TLS {
+		config, err := tlsutil.NewServerConfig(args.TLSCert, args.TLSKey, args.TLSClientCA, log)
+		if err != nil {
+			panic(err)
+		}
+
+		wp = registerHttpsSrv(addr, router, config)
+	} else {
+		wp = http_srv.RegisterHttpSrv(addr, router)
+	}
+
+	if err := wp.RegisterSignal(os.Kill, os.Interrupt).Run(); err != nil {
 		log.Error("failed to start http server", "error", err)
 	}
 }
+
+// registerHttpsSrv registers an https server the same way http_srv.RegisterHttpSrv registers an http one.
+func registerHttpsSrv(addr string, handler http.Handler, config *tls.Config) *waitprocess.WaitProcess {
+	srv := http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: config,
+	}
+
+	return waitprocess.RegisterProcess("https_srv", waitprocess.RunWithStopFunc(
+		func() error {
+			// the certificate comes from TLSConfig.GetCertificate
+			err := srv.ListenAndServeTLS("", "")
+			if err != nil && err != http.ErrServerClosed {
+				return err
+			}
+
+			return nil
+		},
+		func() {
+			ctx, cancel := context.WithTimeout(context.Background(), httpsShutdownTimeout)
+			defer cancel()
+
+			if err := srv.Shutdown(ctx); err != nil {
+				slog.Error("failed to shutdown https server", "error", err)
+			}
+		},
+	))
+}
@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have refilled completely are dropped.
+const sweepInterval = time.Minute
+
+// Limit is a token bucket refilling with Rate tokens per second up to Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled returns true if the limit restricts anything.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return ""
+	}
+
+	return fmt.Sprintf("%g/s:%d", l.Rate, l.Burst)
+}
+
+var limitUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+// ParseLimit parses a limit like "30/m" or "5/s:20", the count per second, minute or hour
+// followed by an optional burst, which defaults to the count. An empty string or "0" disables the limit.
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return Limit{}, nil
+	}
+
+	rate, burst, hasBurst := strings.Cut(value, ":")
+	count, unit, ok := strings.Cut(rate, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <count>/<s|m|h>[:burst]", value)
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid count of rate limit %q", value)
+	}
+
+	per, ok := limitUnits[unit]
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid unit of rate limit %q", value)
+	}
+
+	limit := Limit{Rate: float64(n) / per.Seconds(), Burst: n}
+	if hasBurst {
+		if limit.Burst, err = strconv.Atoi(burst); err != nil || limit.Burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid burst of rate limit %q", value)
+		}
+	}
+
+	return limit, nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps a token bucket per key, e.g. per client address.
+type Limiter struct {
+	limit     Limit
+	lock      sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of every key, but only if none of them is empty. Otherwise it returns false
+// and how long it takes until every bucket has a token again.
+func (l *Limiter) Allow(keys ...string) (bool, time.Duration) {
+	if !l.limit.Enabled() {
+		return true, 0
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	ok, wait := true, time.Duration(0)
+	buckets := make([]*bucket, 0, len(keys))
+	for _, key := range keys {
+		b, exist := l.buckets[key]
+		if !exist {
+			b = &bucket{tokens: float64(l.limit.Burst), last: now}
+			l.buckets[key] = b
+		}
+
+		b.tokens = math.Min(float64(l.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+		b.last = now
+		buckets = append(buckets, b)
+
+		if b.tokens < 1 {
+			ok = false
+			wait = max(wait, time.Duration((1-b.tokens)/l.limit.Rate*float64(time.Second)))
+		}
+	}
+
+	if !ok {
+		return false, wait
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true, 0
+}
+
+// sweep drops the buckets that are full again, they behave the same as missing ones.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+
+	l.lastSweep = now
+	refill := time.Duration(float64(l.limit.Burst) / l.limit.Rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
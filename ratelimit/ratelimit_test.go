@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	t.Run("test ParseLimit()", func(t *testing.T) {
+		limit, err := ParseLimit("30/m")
+		assert.NoError(t, err)
+		assert.Equal(t, Limit{Rate: 0.5, Burst: 30}, limit)
+
+		limit, err = ParseLimit("5/s:20")
+		assert.NoError(t, err)
+		assert.Equal(t, Limit{Rate: 5, Burst: 20}, limit)
+
+		limit, err = ParseLimit("")
+		assert.NoError(t, err)
+		assert.False(t, limit.Enabled())
+
+		limit, err = ParseLimit("0")
+		assert.NoError(t, err)
+		assert.False(t, limit.Enabled())
+	})
+
+	t.Run("test invalid", func(t *testing.T) {
+		for _, value := range []string{"30", "x/m", "-1/m", "30/d", "30/m:0", "30/m:x"} {
+			_, err := ParseLimit(value)
+			assert.Error(t, err, value)
+		}
+	})
+}
+
+func TestLimiter(t *testing.T) {
+	t.Run("test Allow()", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		l := NewLimiter(Limit{Rate: 1, Burst: 2})
+		l.now = func() time.Time { return now }
+
+		ok, _ := l.Allow("a")
+		assert.True(t, ok)
+		ok, _ = l.Allow("a")
+		assert.True(t, ok)
+
+		ok, wait := l.Allow("a")
+		assert.False(t, ok)
+		assert.Equal(t, time.Second, wait)
+
+		// other keys have their own bucket
+		ok, _ = l.Allow("b")
+		assert.True(t, ok)
+
+		now = now.Add(500 * time.Millisecond)
+		ok, wait = l.Allow("a")
+		assert.False(t, ok)
+		assert.Equal(t, 500*time.Millisecond, wait)
+
+		now = now.Add(500 * time.Millisecond)
+		ok, _ = l.Allow("a")
+		assert.True(t, ok)
+	})
+
+	t.Run("test Allow() several keys", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		l := NewLimiter(Limit{Rate: 1, Burst: 1})
+		l.now = func() time.Time { return now }
+
+		ok, _ := l.Allow("a", "b")
+		assert.True(t, ok)
+
+		// the empty bucket of a rejects the request, the bucket of c keeps its token
+		ok, wait := l.Allow("c", "a")
+		assert.False(t, ok)
+		assert.Equal(t, time.Second, wait)
+
+		ok, _ = l.Allow("c")
+		assert.True(t, ok)
+	})
+
+	t.Run("test disabled", func(t *testing.T) {
+		l := NewLimiter(Limit{})
+		for i := 0; i < 100; i++ {
+			ok, _ := l.Allow("a")
+			assert.True(t, ok)
+		}
+	})
+
+	t.Run("test sweep", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		l := NewLimiter(Limit{Rate: 1, Burst: 2})
+		l.now = func() time.Time { return now }
+
+		l.Allow("a")
+		now = now.Add(sweepInterval)
+		l.Allow("b")
+		assert.Len(t, l.buckets, 1)
+	})
+}
@@ -0,0 +1,206 @@
+package recorder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// AsciicastExt is the file extension of asciinema recordings.
+const AsciicastExt = ".cast"
+
+// ErrInvalidSid is returned for session ids that can not be part of a file name, e.g. ../x.
+var ErrInvalidSid = errors.New("session id is not valid in a file name")
+
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// asciicast writes an asciinema v2 recording: a JSON header line followed by one JSON array per event.
+type asciicast struct {
+	lock  sync.Mutex
+	w     io.WriteCloser
+	start time.Time
+	// pending is the start of a UTF-8 sequence that continues in the next output
+	pending []byte
+}
+
+// NewAsciicast writes the header to w and returns a recorder writing the events after it.
+func NewAsciicast(w io.WriteCloser, header Header) (Recorder, error) {
+	line, err := json.Marshal(asciicastHeader{
+		Version:   2,
+		Width:     header.Width,
+		Height:    header.Height,
+		Timestamp: header.Timestamp.Unix(),
+		Command:   header.Command,
+		Title:     header.Title,
+		Env:       header.Env,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal asciicast header: %w", err)
+	}
+
+	if _, err := w.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to write asciicast header: %w", err)
+	}
+
+	return &asciicast{w: w, start: header.Timestamp}, nil
+}
+
+// CreateAsciicast creates the asciinema recording of a session in dir, named after the sid and the start time.
+func CreateAsciicast(dir string, sid string, header Header) (Recorder, error) {
+	return Create(dir, sid, Asciicast, header)
+}
+
+// FileName returns the name of a recording without extension, e.g. <sid>-20240501T100000Z.
+func FileName(sid string, start time.Time) string {
+	return sid + "-" + start.UTC().Format("20060102T150405Z")
+}
+
+// checkSid returns ErrInvalidSid unless the sid can name a recording, clients choose the ids of legacy sessions.
+func checkSid(sid string) error {
+	if !recordingIdPattern.MatchString(sid) {
+		return fmt.Errorf("%w: %q", ErrInvalidSid, sid)
+	}
+
+	return nil
+}
+
+// createFile creates a recording file that must not exist yet, and its directory if needed.
+func createFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+
+	return file, nil
+}
+
+func (a *asciicast) WriteOutput(at time.Time, data []byte) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	data = append(a.pending, data...)
+	a.pending = nil
+
+	// events are JSON strings, a UTF-8 sequence split across reads must not be broken
+	if cut := incompleteSuffix(data); cut > 0 {
+		a.pending = append([]byte{}, data[len(data)-cut:]...)
+		data = data[:len(data)-cut]
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	return a.writeEvent(at, "o", string(data))
+}
+
+func (a *asciicast) WriteResize(at time.Time, width, height int) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.writeEvent(at, "r", fmt.Sprintf("%dx%d", width, height))
+}
+
+func (a *asciicast) writeEvent(at time.Time, code string, data string) error {
+	line, err := json.Marshal([]any{at.Sub(a.start).Seconds(), code, data})
+	if err != nil {
+		return fmt.Errorf("failed to marshal asciicast event: %w", err)
+	}
+
+	if _, err := a.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write asciicast event: %w", err)
+	}
+
+	return nil
+}
+
+func (a *asciicast) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if len(a.pending) > 0 {
+		a.writeEvent(time.Now(), "o", string(a.pending))
+		a.pending = nil
+	}
+
+	return a.w.Close()
+}
+
+// incompleteSuffix returns the length of a UTF-8 sequence at the end of data that is not complete yet.
+func incompleteSuffix(data []byte) int {
+	for i := 1; i <= utf8.UTFMax-1 && i <= len(data); i++ {
+		c := data[len(data)-i]
+		if c < 0x80 {
+			return 0
+		}
+
+		if utf8.RuneStart(c) {
+			if utf8.FullRune(data[len(data)-i:]) {
+				return 0
+			}
+
+			return i
+		}
+	}
+
+	return 0
+}
+
+// asciicastFormat reads and writes asciinema v2 recordings.
+type asciicastFormat struct{}
+
+func (asciicastFormat) Name() string {
+	return "asciicast"
+}
+
+func (asciicastFormat) Ext() string {
+	return AsciicastExt
+}
+
+func (asciicastFormat) Create(path string, header Header) (Recorder, error) {
+	file, err := createFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rec, err := NewAsciicast(file, header)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func (asciicastFormat) Open(path string) (Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+
+	reader, err := NewAsciicastReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &fileReader{eventReader: reader, Closer: file}, nil
+}
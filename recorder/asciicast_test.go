@@ -0,0 +1,78 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type nopCloser struct {
+	bytes.Buffer
+}
+
+func (n *nopCloser) Close() error {
+	return nil
+}
+
+func TestAsciicast(t *testing.T) {
+	t.Run("test events", func(t *testing.T) {
+		start := time.Unix(1714557600, 0)
+		buff := &nopCloser{}
+
+		rec, err := NewAsciicast(buff, Header{Width: 80, Height: 24, Timestamp: start, Command: "bash", Env: map[string]string{"TERM": "xterm"}})
+		assert.NoError(t, err)
+
+		assert.NoError(t, rec.WriteOutput(start.Add(500*time.Millisecond), []byte("hello\r\n")))
+		assert.NoError(t, rec.WriteResize(start.Add(time.Second), 100, 30))
+		assert.NoError(t, rec.Close())
+
+		lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+		assert.Len(t, lines, 3)
+		assert.JSONEq(t, `{"version":2,"width":80,"height":24,"timestamp":1714557600,"command":"bash","env":{"TERM":"xterm"}}`, lines[0])
+		assert.JSONEq(t, `[0.5,"o","hello\r\n"]`, lines[1])
+		assert.JSONEq(t, `[1,"r","100x30"]`, lines[2])
+	})
+
+	t.Run("test split utf-8", func(t *testing.T) {
+		start := time.Unix(0, 0)
+		buff := &nopCloser{}
+
+		rec, err := NewAsciicast(buff, Header{Width: 80, Height: 24, Timestamp: start})
+		assert.NoError(t, err)
+
+		snowman := []byte("☃")
+		assert.NoError(t, rec.WriteOutput(start, append([]byte("a"), snowman[:1]...)))
+		assert.NoError(t, rec.WriteOutput(start, snowman[1:2]))
+		assert.NoError(t, rec.WriteOutput(start, snowman[2:]))
+		assert.NoError(t, rec.Close())
+
+		lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+		assert.Len(t, lines, 3)
+
+		var event []any
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+		assert.Equal(t, "a", event[2])
+		assert.NoError(t, json.Unmarshal([]byte(lines[2]), &event))
+		assert.Equal(t, "☃", event[2])
+	})
+
+	t.Run("test CreateAsciicast()", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "recordings")
+		start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+		rec, err := CreateAsciicast(dir, "abc", Header{Width: 80, Height: 24, Timestamp: start})
+		assert.NoError(t, err)
+		assert.NoError(t, rec.Close())
+
+		_, err = os.Stat(filepath.Join(dir, "abc-20240501T100000Z.cast"))
+		assert.NoError(t, err)
+
+		_, err = CreateAsciicast(dir, "abc", Header{Width: 80, Height: 24, Timestamp: start})
+		assert.Error(t, err)
+	})
+}
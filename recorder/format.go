@@ -0,0 +1,144 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnknownFormat = errors.New("unknown recording format")
+
+// Format is a file format recordings are written and read in.
+type Format interface {
+	// Name selects the format, e.g. on the command line.
+	Name() string
+	// Ext is the extension of the recording file.
+	Ext() string
+	// Create creates the recording at path, which must not exist yet.
+	Create(path string, header Header) (Recorder, error)
+	// Open opens the recording at path for reading.
+	Open(path string) (Reader, error)
+}
+
+// Reader reads the events of a recording one by one.
+type Reader interface {
+	// Header describes the recording, formats that do not store the size leave it 0.
+	Header() Header
+	// Next returns the next event, io.EOF at the end of the recording.
+	Next() (Event, error)
+	Close() error
+}
+
+var (
+	// Asciicast is the asciinema v2 format, the only one the player can play.
+	Asciicast Format = asciicastFormat{}
+	// Ttyrec is the format of ttyrec and ttyplay, it does not keep size changes.
+	Ttyrec Format = ttyrecFormat{}
+	// Script is the typescript and timing file of util-linux script and scriptreplay, it does not keep size changes.
+	Script Format = scriptFormat{}
+)
+
+// Formats returns all supported formats.
+func Formats() []Format {
+	return []Format{Asciicast, Ttyrec, Script}
+}
+
+// FormatByName returns the format with the name.
+func FormatByName(name string) (Format, error) {
+	for _, format := range Formats() {
+		if format.Name() == name {
+			return format, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, name)
+}
+
+// FormatByPath returns the format a file is in by its extension.
+func FormatByPath(path string) (Format, error) {
+	for _, format := range Formats() {
+		if strings.HasSuffix(path, format.Ext()) {
+			return format, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, filepath.Base(path))
+}
+
+// Create creates the recording of a session in dir in the format, named after the sid and the start time.
+func Create(dir string, sid string, format Format, header Header) (Recorder, error) {
+	if err := checkSid(sid); err != nil {
+		return nil, err
+	}
+
+	return format.Create(filepath.Join(dir, FileName(sid, header.Timestamp)+format.Ext()), header)
+}
+
+// Convert writes the events r reads to w, at the same times relative to the start of the recording.
+func Convert(r Reader, w Recorder) error {
+	start := r.Header().Timestamp
+
+	for {
+		event, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		at := start.Add(time.Duration(event.Time * float64(time.Second)))
+
+		switch event.Code {
+		case "o":
+			err = w.WriteOutput(at, []byte(event.Data))
+		case "r":
+			width, height, ok := parseSize(event.Data)
+			if !ok {
+				return fmt.Errorf("invalid resize event: %q", event.Data)
+			}
+
+			err = w.WriteResize(at, width, height)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseSize parses the size of a resize event, e.g. 80x24.
+func parseSize(data string) (int, int, bool) {
+	w, h, ok := strings.Cut(data, "x")
+	if !ok {
+		return 0, 0, false
+	}
+
+	width, err := strconv.Atoi(w)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	height, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return width, height, true
+}
+
+type eventReader interface {
+	Header() Header
+	Next() (Event, error)
+}
+
+// fileReader closes the file an eventReader reads.
+type fileReader struct {
+	eventReader
+	io.Closer
+}
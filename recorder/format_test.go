@@ -0,0 +1,172 @@
+package recorder
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readAll returns the events of a recording.
+func readAll(t *testing.T, r Reader) []Event {
+	var events []Event
+	for {
+		event, err := r.Next()
+		if err == io.EOF {
+			return events
+		}
+
+		assert.NoError(t, err)
+		events = append(events, event)
+	}
+}
+
+func TestTtyrec(t *testing.T) {
+	t.Run("test records", func(t *testing.T) {
+		start := time.Unix(1714557600, 250000000)
+		buff := &nopCloser{}
+
+		rec := NewTtyrec(buff)
+		assert.NoError(t, rec.WriteOutput(start, []byte("hello")))
+		assert.NoError(t, rec.WriteResize(start.Add(time.Second), 100, 30))
+		assert.NoError(t, rec.WriteOutput(start.Add(1500*time.Millisecond), []byte("world")))
+		assert.NoError(t, rec.Close())
+
+		assert.Equal(t, []byte{0xa0, 0x12, 0x32, 0x66, 0x90, 0xd0, 0x03, 0x00, 5, 0, 0, 0}, buff.Bytes()[:ttyrecHeaderSize])
+
+		reader, err := NewTtyrecReader(bytes.NewReader(buff.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, start, reader.Header().Timestamp)
+
+		events := readAll(t, &fileReader{eventReader: reader, Closer: io.NopCloser(nil)})
+		assert.Equal(t, []Event{{Time: 0, Code: "o", Data: "hello"}, {Time: 1.5, Code: "o", Data: "world"}}, events)
+	})
+
+	t.Run("test truncated", func(t *testing.T) {
+		reader, err := NewTtyrecReader(bytes.NewReader([]byte{0, 0, 0, 0, 0, 0, 0, 0, 5, 0, 0, 0, 'h'}))
+		assert.Error(t, err)
+		assert.Nil(t, reader)
+	})
+}
+
+func TestScript(t *testing.T) {
+	t.Run("test typescript and timing", func(t *testing.T) {
+		start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		typescript, timing := &nopCloser{}, &nopCloser{}
+
+		rec, err := NewScript(typescript, timing, Header{Width: 80, Height: 24, Timestamp: start, Command: "bash", Env: map[string]string{"TERM": "xterm"}})
+		assert.NoError(t, err)
+		assert.NoError(t, rec.WriteOutput(start.Add(500*time.Millisecond), []byte("hello\r\n")))
+		assert.NoError(t, rec.WriteOutput(start.Add(2*time.Second), []byte("world")))
+		assert.NoError(t, rec.Close())
+
+		assert.True(t, strings.HasPrefix(typescript.String(),
+			"Script started on 2024-05-01 10:00:00+00:00 [COMMAND=\"bash\" TERM=\"xterm\" COLUMNS=\"80\" LINES=\"24\"]\nhello\r\nworld\nScript done on "))
+		assert.Equal(t, "0.500000 7\n1.500000 5\n", timing.String())
+
+		reader, err := NewScriptReader(strings.NewReader(typescript.String()), strings.NewReader(timing.String()))
+		assert.NoError(t, err)
+
+		header := reader.Header()
+		assert.True(t, start.Equal(header.Timestamp))
+		assert.Equal(t, 80, header.Width)
+		assert.Equal(t, 24, header.Height)
+		assert.Equal(t, "bash", header.Command)
+
+		events := readAll(t, &fileReader{eventReader: reader, Closer: io.NopCloser(nil)})
+		assert.Equal(t, []Event{{Time: 0.5, Code: "o", Data: "hello\r\n"}, {Time: 2, Code: "o", Data: "world"}}, events)
+	})
+
+	t.Run("test advanced timing", func(t *testing.T) {
+		typescript := "Script started on 2024-05-01 10:00:00+00:00 [TERM=\"xterm\"]\nab"
+		timing := "H 0 START_TIME 2024-05-01 10:00:00\nI 0.1 3\nO 0.2 1\nO 0.3 1\n"
+
+		reader, err := NewScriptReader(strings.NewReader(typescript), strings.NewReader(timing))
+		assert.NoError(t, err)
+
+		events := readAll(t, &fileReader{eventReader: reader, Closer: io.NopCloser(nil)})
+		assert.Equal(t, []Event{{Time: 0.2, Code: "o", Data: "a"}, {Time: 0.5, Code: "o", Data: "b"}}, events)
+	})
+
+	t.Run("test no header", func(t *testing.T) {
+		_, err := NewScriptReader(strings.NewReader("hello\n"), strings.NewReader(""))
+		assert.Error(t, err)
+	})
+}
+
+func TestFormat(t *testing.T) {
+	t.Run("test FormatByName()/FormatByPath()", func(t *testing.T) {
+		format, err := FormatByName("ttyrec")
+		assert.NoError(t, err)
+		assert.Equal(t, Ttyrec, format)
+
+		format, err = FormatByPath("/tmp/session.typescript")
+		assert.NoError(t, err)
+		assert.Equal(t, Script, format)
+
+		_, err = FormatByName("mp4")
+		assert.ErrorIs(t, err, ErrUnknownFormat)
+
+		_, err = FormatByPath("session.mp4")
+		assert.ErrorIs(t, err, ErrUnknownFormat)
+	})
+
+	t.Run("test Create()", func(t *testing.T) {
+		dir := t.TempDir()
+		start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+		rec, err := Create(dir, "abc", Script, Header{Timestamp: start})
+		assert.NoError(t, err)
+		assert.NoError(t, rec.Close())
+
+		for _, name := range []string{"abc-20240501T100000Z.typescript", "abc-20240501T100000Z.timing"} {
+			_, err = os.Stat(filepath.Join(dir, name))
+			assert.NoError(t, err)
+		}
+	})
+}
+
+func TestConvert(t *testing.T) {
+	t.Run("test Convert() between all formats", func(t *testing.T) {
+		dir := t.TempDir()
+		start := time.Unix(1714557600, 0)
+		header := Header{Width: 80, Height: 24, Timestamp: start}
+
+		rec, err := Asciicast.Create(filepath.Join(dir, "source.cast"), header)
+		assert.NoError(t, err)
+		assert.NoError(t, rec.WriteOutput(start.Add(500*time.Millisecond), []byte("hello ☃\r\n")))
+		assert.NoError(t, rec.WriteResize(start.Add(time.Second), 100, 30))
+		assert.NoError(t, rec.WriteOutput(start.Add(2*time.Second), []byte("bye")))
+		assert.NoError(t, rec.Close())
+
+		source := filepath.Join(dir, "source.cast")
+		for _, format := range []Format{Ttyrec, Script, Asciicast} {
+			target := filepath.Join(dir, "converted-"+format.Name()+format.Ext())
+
+			reader, err := Asciicast.Open(source)
+			assert.NoError(t, err)
+
+			rec, err := format.Create(target, reader.Header())
+			assert.NoError(t, err)
+			assert.NoError(t, Convert(reader, rec))
+			assert.NoError(t, rec.Close())
+			assert.NoError(t, reader.Close())
+
+			reader, err = format.Open(target)
+			assert.NoError(t, err)
+
+			var output []string
+			for _, event := range readAll(t, reader) {
+				if event.Code == "o" {
+					output = append(output, event.Data)
+				}
+			}
+			assert.NoError(t, reader.Close())
+			assert.Equal(t, []string{"hello ☃\r\n", "bye"}, output, format.Name())
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// InputLogExt is the file extension of input logs.
+const InputLogExt = ".input.jsonl"
+
+// InputEntry is a piece of input typed into a session.
+// Input typed while the terminal did not echo, e.g. a password, is only noted as redacted.
+type InputEntry struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user,omitempty"`
+	Data     string    `json:"data,omitempty"`
+	Redacted bool      `json:"redacted,omitempty"`
+}
+
+// InputLog writes the input of a session as JSON lines.
+type InputLog struct {
+	lock sync.Mutex
+	w    io.WriteCloser
+}
+
+func NewInputLog(w io.WriteCloser) *InputLog {
+	return &InputLog{w: w}
+}
+
+// CreateInputLog creates the input log of a session in dir, named like its recording.
+func CreateInputLog(dir string, sid string, start time.Time) (*InputLog, error) {
+	if err := checkSid(sid); err != nil {
+		return nil, err
+	}
+
+	file, err := createFile(filepath.Join(dir, FileName(sid, start)+InputLogExt))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewInputLog(file), nil
+}
+
+func (l *InputLog) Write(entry InputEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal input entry: %w", err)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write input log: %w", err)
+	}
+
+	return nil
+}
+
+func (l *InputLog) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.w.Close()
+}
@@ -0,0 +1,42 @@
+package recorder
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInputLog(t *testing.T) {
+	t.Run("test Write()", func(t *testing.T) {
+		buff := &nopCloser{}
+		log := NewInputLog(buff)
+
+		at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+		assert.NoError(t, log.Write(InputEntry{Time: at, User: "alice", Data: "ls\r"}))
+		assert.NoError(t, log.Write(InputEntry{Time: at, User: "alice", Redacted: true}))
+		assert.NoError(t, log.Close())
+
+		lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+		assert.Len(t, lines, 2)
+		assert.JSONEq(t, `{"time":"2024-05-01T10:00:00Z","user":"alice","data":"ls\r"}`, lines[0])
+		assert.JSONEq(t, `{"time":"2024-05-01T10:00:00Z","user":"alice","redacted":true}`, lines[1])
+	})
+
+	t.Run("test CreateInputLog()", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "input")
+		start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+		log, err := CreateInputLog(dir, "abc", start)
+		assert.NoError(t, err)
+		assert.NoError(t, log.Close())
+		assert.FileExists(t, filepath.Join(dir, "abc-20240501T100000Z"+InputLogExt))
+
+		_, err = CreateInputLog(dir, "../../x", start)
+		assert.ErrorIs(t, err, ErrInvalidSid)
+		entries, _ := os.ReadDir(filepath.Dir(dir))
+		assert.Len(t, entries, 1)
+	})
+}
@@ -0,0 +1,357 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxEventSize is the longest event line a recording may contain.
+const maxEventSize = 4 << 20
+
+// tailSize is how much of the end of a recording is read to find its duration.
+const tailSize = 64 << 10
+
+var (
+	ErrRecordingNotFound = errors.New("recording not found")
+
+	recordingIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// Event is an event of an asciinema recording.
+type Event struct {
+	// Time is the number of seconds since the start of the recording.
+	Time float64
+	Code string
+	Data string
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{e.Time, e.Code, e.Data})
+}
+
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	if len(fields) != 3 {
+		return fmt.Errorf("event has %d fields, expected 3", len(fields))
+	}
+
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return fmt.Errorf("invalid event time: %w", err)
+	}
+
+	if err := json.Unmarshal(fields[1], &e.Code); err != nil {
+		return fmt.Errorf("invalid event code: %w", err)
+	}
+
+	return json.Unmarshal(fields[2], &e.Data)
+}
+
+// AsciicastReader reads the events of an asciinema v2 recording one by one.
+type AsciicastReader struct {
+	header  Header
+	scanner *bufio.Scanner
+}
+
+func NewAsciicastReader(r io.Reader) (*AsciicastReader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxEventSize)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read asciicast header: %w", err)
+		}
+
+		return nil, fmt.Errorf("asciicast is empty")
+	}
+
+	var header asciicastHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, fmt.Errorf("invalid asciicast header: %w", err)
+	}
+
+	if header.Version != 2 {
+		return nil, fmt.Errorf("unsupported asciicast version: %d", header.Version)
+	}
+
+	return &AsciicastReader{
+		header: Header{
+			Width:     header.Width,
+			Height:    header.Height,
+			Timestamp: time.Unix(header.Timestamp, 0),
+			Command:   header.Command,
+			Title:     header.Title,
+			Env:       header.Env,
+		},
+		scanner: scanner,
+	}, nil
+}
+
+// Header returns the header of the recording.
+func (r *AsciicastReader) Header() Header {
+	return r.header
+}
+
+// Next returns the next event, io.EOF at the end of the recording.
+func (r *AsciicastReader) Next() (Event, error) {
+	for r.scanner.Scan() {
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return Event{}, fmt.Errorf("invalid asciicast event: %w", err)
+		}
+
+		return event, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return Event{}, fmt.Errorf("failed to read asciicast event: %w", err)
+	}
+
+	return Event{}, io.EOF
+}
+
+// Info describes a recording in a directory.
+type Info struct {
+	Id string `json:"id"`
+	// User owns it: the user, or the client of an anonymous session, empty for recordings nobody owns.
+	User string `json:"user,omitempty"`
+	Sid  string `json:"sid"`
+	// Profile is the profile the session was started with, empty for recordings without metadata.
+	Profile  string    `json:"profile"`
+	Start    time.Time `json:"start"`
+	Width    int       `json:"width"`
+	Height   int       `json:"height"`
+	Command  string    `json:"command"`
+	Title    string    `json:"title"`
+	Duration float64   `json:"duration"`
+	Size     int64     `json:"size"`
+}
+
+// castFile is an asciinema recording file, possibly gzipped.
+type castFile struct {
+	id   string
+	user string
+	path string
+}
+
+// List returns the asciinema recordings in dir and in the directories of its users, newest first.
+// Files that are not valid recordings are skipped.
+func List(dir string) ([]Info, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	casts := castFiles(dir, "", entries)
+	for _, entry := range entries {
+		user, err := url.PathUnescape(entry.Name())
+		if !entry.IsDir() || err != nil {
+			continue
+		}
+
+		userEntries, err := os.ReadDir(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		casts = append(casts, castFiles(filepath.Join(dir, entry.Name()), user, userEntries)...)
+	}
+
+	infos := make([]Info, 0, len(casts))
+	for _, cast := range casts {
+		info, err := stat(cast)
+		if err != nil {
+			continue
+		}
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Start.After(infos[j].Start)
+	})
+
+	return infos, nil
+}
+
+func castFiles(dir string, user string, entries []os.DirEntry) []castFile {
+	var casts []castFile
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), GzipExt)
+		id, ok := strings.CutSuffix(name, AsciicastExt)
+		if !ok || entry.IsDir() || !recordingIdPattern.MatchString(id) {
+			continue
+		}
+
+		casts = append(casts, castFile{id: id, user: user, path: filepath.Join(dir, entry.Name())})
+	}
+
+	return casts
+}
+
+// Stat returns the description of the recording with the id that owner has in dir, empty for nobody.
+func Stat(dir string, owner string, id string) (Info, error) {
+	cast, err := locate(dir, owner, id)
+	if err != nil {
+		return Info{}, err
+	}
+
+	return stat(cast)
+}
+
+func stat(cast castFile) (Info, error) {
+	file, err := openCast(cast.path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer file.Close()
+
+	fileInfo, err := os.Stat(cast.path)
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to stat recording: %w", err)
+	}
+
+	// only the header is read, a compressed recording is not decompressed any further
+	reader, err := NewAsciicastReader(io.LimitReader(file, maxEventSize))
+	if err != nil {
+		return Info{}, err
+	}
+
+	// finished recordings have their duration in the metadata, the others are plain files still being written
+	m, _ := readMeta(castName(cast.path))
+	if plain, ok := file.(*os.File); ok && !m.Finished {
+		m.Duration = duration(plain, fileInfo.Size())
+	}
+
+	return newInfo(cast, reader.Header(), m, fileInfo.Size()), nil
+}
+
+// castName returns the path of the recording without extension.
+func castName(path string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(path, GzipExt), AsciicastExt)
+}
+
+// newInfo describes the recording in the cast file.
+func newInfo(cast castFile, header Header, m meta, size int64) Info {
+	sid := cast.id
+	if i := strings.LastIndex(cast.id, "-"); i > 0 {
+		sid = cast.id[:i]
+	}
+
+	return Info{
+		Id:       cast.id,
+		User:     cast.user,
+		Sid:      sid,
+		Profile:  m.Profile,
+		Start:    header.Timestamp,
+		Width:    header.Width,
+		Height:   header.Height,
+		Command:  header.Command,
+		Title:    header.Title,
+		Duration: m.Duration,
+		Size:     size,
+	}
+}
+
+// Open opens the recording with the id that owner has in dir, ids that could name a file elsewhere are rejected.
+// Compressed recordings are decompressed while they are read.
+func Open(dir string, owner string, id string) (io.ReadCloser, error) {
+	cast, err := locate(dir, owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return openCast(cast.path)
+}
+
+// locate finds the recording with the id in the directory of owner, the recordings of others are not found.
+func locate(dir string, owner string, id string) (castFile, error) {
+	if !recordingIdPattern.MatchString(id) {
+		return castFile{}, ErrRecordingNotFound
+	}
+
+	for _, ext := range []string{AsciicastExt, AsciicastExt + GzipExt} {
+		path := filepath.Join(ownerDir(dir, owner), id+ext)
+		if _, err := os.Stat(path); err == nil {
+			return castFile{id: id, user: owner, path: path}, nil
+		}
+	}
+
+	return castFile{}, ErrRecordingNotFound
+}
+
+func openCast(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrRecordingNotFound
+		}
+
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+
+	if !strings.HasSuffix(path, GzipExt) {
+		return file, nil
+	}
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open compressed recording: %w", err)
+	}
+
+	return &gzipFile{Reader: zr, file: file}, nil
+}
+
+// gzipFile decompresses a file while it is read.
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	return errors.Join(g.Reader.Close(), g.file.Close())
+}
+
+// duration returns the time of the last event, read from the tail of the file.
+func duration(file *os.File, size int64) float64 {
+	offset := max(size-tailSize, 0)
+	buff := make([]byte, size-offset)
+	if _, err := file.ReadAt(buff, offset); err != nil && err != io.EOF {
+		return 0
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buff), []byte{'\n'})
+	for i := len(lines) - 1; i >= 0; i-- {
+		var event Event
+		if err := json.Unmarshal(lines[i], &event); err == nil {
+			return event.Time
+		}
+	}
+
+	return 0
+}
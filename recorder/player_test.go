@@ -0,0 +1,130 @@
+package recorder
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsciicastReader(t *testing.T) {
+	t.Run("test Next()", func(t *testing.T) {
+		cast := `{"version":2,"width":80,"height":24,"timestamp":1714557600,"title":"default"}
+[0.5,"o","hello"]
+
+[1,"r","100x30"]
+`
+		reader, err := NewAsciicastReader(strings.NewReader(cast))
+		assert.NoError(t, err)
+		assert.Equal(t, 80, reader.Header().Width)
+		assert.Equal(t, "default", reader.Header().Title)
+
+		event, err := reader.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, Event{Time: 0.5, Code: "o", Data: "hello"}, event)
+
+		event, err = reader.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, Event{Time: 1, Code: "r", Data: "100x30"}, event)
+
+		_, err = reader.Next()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("test invalid", func(t *testing.T) {
+		_, err := NewAsciicastReader(strings.NewReader(""))
+		assert.Error(t, err)
+
+		_, err = NewAsciicastReader(strings.NewReader(`{"version":1}`))
+		assert.Error(t, err)
+
+		reader, err := NewAsciicastReader(strings.NewReader("{\"version\":2}\n[1,\"o\"]\n"))
+		assert.NoError(t, err)
+		_, err = reader.Next()
+		assert.Error(t, err)
+	})
+}
+
+func TestList(t *testing.T) {
+	t.Run("test List()", func(t *testing.T) {
+		dir := t.TempDir()
+		start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+		for i, sid := range []string{"a-b", "c"} {
+			rec, err := CreateAsciicast(dir, sid, Header{Width: 80, Height: 24, Timestamp: start.Add(time.Duration(i) * time.Hour), Title: "default"})
+			assert.NoError(t, err)
+			assert.NoError(t, rec.WriteOutput(start.Add(time.Duration(i)*time.Hour+2*time.Second), []byte("x")))
+			assert.NoError(t, rec.Close())
+		}
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.cast"), []byte("nope"), 0600))
+
+		infos, err := List(dir)
+		assert.NoError(t, err)
+		assert.Len(t, infos, 2)
+		assert.Equal(t, "c", infos[0].Sid)
+		assert.Equal(t, "a-b", infos[1].Sid)
+		assert.Equal(t, "a-b-20240501T100000Z", infos[1].Id)
+		assert.Equal(t, 2.0, infos[1].Duration)
+
+		infos, err = List(filepath.Join(dir, "missing"))
+		assert.NoError(t, err)
+		assert.Empty(t, infos)
+	})
+
+	t.Run("test List() compressed", func(t *testing.T) {
+		dir := t.TempDir()
+		start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+		rec, err := CreateAsciicast(dir, "abc", Header{Width: 80, Height: 24, Timestamp: start})
+		assert.NoError(t, err)
+		assert.NoError(t, rec.WriteOutput(start.Add(2*time.Second), []byte("x")))
+		assert.NoError(t, rec.Close())
+		assert.NoError(t, compressFile(filepath.Join(dir, "abc-20240501T100000Z.cast")))
+
+		// the events of a compressed recording are not read to list it
+		infos, err := List(dir)
+		assert.NoError(t, err)
+		assert.Len(t, infos, 1)
+		assert.Equal(t, 80, infos[0].Width)
+		assert.Equal(t, 0.0, infos[0].Duration)
+
+		assert.NoError(t, writeMeta(filepath.Join(dir, "abc-20240501T100000Z"), meta{Finished: true, Duration: 2}))
+		infos, err = List(dir)
+		assert.NoError(t, err)
+		assert.Len(t, infos, 1)
+		assert.Equal(t, 2.0, infos[0].Duration)
+	})
+
+	t.Run("test Open()", func(t *testing.T) {
+		_, err := Open(t.TempDir(), "", "../secret")
+		assert.ErrorIs(t, err, ErrRecordingNotFound)
+
+		_, err = Open(t.TempDir(), "", "missing")
+		assert.ErrorIs(t, err, ErrRecordingNotFound)
+	})
+
+	t.Run("test Stat() of another owner", func(t *testing.T) {
+		dir := t.TempDir()
+		start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+		for _, owner := range []string{"alice", "bob"} {
+			rec, err := CreateAsciicast(ownerDir(dir, owner), "abc", Header{Width: 80, Height: 24, Timestamp: start, Title: owner})
+			assert.NoError(t, err)
+			assert.NoError(t, rec.Close())
+		}
+
+		info, err := Stat(dir, "bob", "abc-20240501T100000Z")
+		assert.NoError(t, err)
+		assert.Equal(t, "bob", info.User)
+		assert.Equal(t, "bob", info.Title)
+
+		_, err = Stat(dir, "mallory", "abc-20240501T100000Z")
+		assert.ErrorIs(t, err, ErrRecordingNotFound)
+
+		_, err = Open(dir, "", "abc-20240501T100000Z")
+		assert.ErrorIs(t, err, ErrRecordingNotFound)
+	})
+}
@@ -0,0 +1,23 @@
+package recorder
+
+import (
+	"time"
+)
+
+// Recorder writes the output and the size changes of a session to a recording.
+// Implementations must be safe for concurrent use, output and resizes arrive from different goroutines.
+type Recorder interface {
+	WriteOutput(at time.Time, data []byte) error
+	WriteResize(at time.Time, width, height int) error
+	Close() error
+}
+
+// Header describes the recorded session.
+type Header struct {
+	Width     int
+	Height    int
+	Timestamp time.Time
+	Command   string
+	Title     string
+	Env       map[string]string
+}
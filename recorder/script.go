@@ -0,0 +1,255 @@
+package recorder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ScriptExt is the file extension of typescripts.
+	ScriptExt = ".typescript"
+	// TimingExt is the file extension of the timing file next to a typescript.
+	TimingExt = ".timing"
+)
+
+// scriptTimeLayout is how util-linux script writes the start and end time.
+const scriptTimeLayout = "2006-01-02 15:04:05-07:00"
+
+var scriptAttrPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// TimingPath returns the path of the timing file of the typescript at path.
+func TimingPath(path string) string {
+	return strings.TrimSuffix(path, ScriptExt) + TimingExt
+}
+
+// script writes a typescript and a timing file like util-linux script --timing, to be played with scriptreplay.
+// The timing file has one line per output with the seconds since the previous output and its size.
+// The classic timing format has no size changes, they are not recorded.
+type script struct {
+	lock       sync.Mutex
+	typescript io.WriteCloser
+	timing     io.WriteCloser
+	last       time.Time
+}
+
+// NewScript writes the typescript header and returns a recorder writing the output after it.
+func NewScript(typescript io.WriteCloser, timing io.WriteCloser, header Header) (Recorder, error) {
+	var attrs []string
+	if header.Command != "" {
+		attrs = append(attrs, fmt.Sprintf("COMMAND=%q", header.Command))
+	}
+	if term := header.Env["TERM"]; term != "" {
+		attrs = append(attrs, fmt.Sprintf("TERM=%q", term))
+	}
+	if header.Width > 0 && header.Height > 0 {
+		attrs = append(attrs, fmt.Sprintf(`COLUMNS="%d" LINES="%d"`, header.Width, header.Height))
+	}
+
+	line := fmt.Sprintf("Script started on %s [%s]\n", header.Timestamp.Format(scriptTimeLayout), strings.Join(attrs, " "))
+	if _, err := io.WriteString(typescript, line); err != nil {
+		return nil, fmt.Errorf("failed to write typescript header: %w", err)
+	}
+
+	return &script{typescript: typescript, timing: timing, last: header.Timestamp}, nil
+}
+
+func (s *script) WriteOutput(at time.Time, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delay := max(at.Sub(s.last), 0)
+	s.last = at
+
+	if _, err := s.typescript.Write(data); err != nil {
+		return fmt.Errorf("failed to write typescript: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(s.timing, "%.6f %d\n", delay.Seconds(), len(data)); err != nil {
+		return fmt.Errorf("failed to write timing: %w", err)
+	}
+
+	return nil
+}
+
+func (s *script) WriteResize(at time.Time, width, height int) error {
+	return nil
+}
+
+func (s *script) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := fmt.Fprintf(s.typescript, "\nScript done on %s\n", time.Now().Format(scriptTimeLayout))
+	return errors.Join(err, s.typescript.Close(), s.timing.Close())
+}
+
+// ScriptReader reads a typescript and its timing file as output events.
+type ScriptReader struct {
+	header     Header
+	typescript *bufio.Reader
+	timing     *bufio.Scanner
+	elapsed    float64
+}
+
+// NewScriptReader reads the typescript header, a start time it can not parse is left zero.
+func NewScriptReader(typescript io.Reader, timing io.Reader) (*ScriptReader, error) {
+	reader := &ScriptReader{typescript: bufio.NewReader(typescript), timing: bufio.NewScanner(timing)}
+
+	line, err := reader.typescript.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read typescript header: %w", err)
+	}
+
+	started, ok := strings.CutPrefix(line, "Script started on ")
+	if !ok {
+		return nil, fmt.Errorf("typescript has no header")
+	}
+
+	started, attrs, _ := strings.Cut(strings.TrimSpace(started), " [")
+	if at, err := time.Parse(scriptTimeLayout, started); err == nil {
+		reader.header.Timestamp = at
+	}
+
+	for _, match := range scriptAttrPattern.FindAllStringSubmatch(attrs, -1) {
+		switch match[1] {
+		case "COMMAND":
+			reader.header.Command = match[2]
+		case "TERM":
+			reader.header.Env = map[string]string{"TERM": match[2]}
+		case "COLUMNS":
+			reader.header.Width, _ = strconv.Atoi(match[2])
+		case "LINES":
+			reader.header.Height, _ = strconv.Atoi(match[2])
+		}
+	}
+
+	return reader, nil
+}
+
+func (r *ScriptReader) Header() Header {
+	return r.header
+}
+
+// Next returns the output of the next timing line. Besides the classic format, the output entries
+// of the advanced timing format are read, its input, signal and header entries are skipped.
+func (r *ScriptReader) Next() (Event, error) {
+	for r.timing.Scan() {
+		fields := strings.Fields(r.timing.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "O" {
+			fields = fields[1:]
+		} else if _, err := strconv.ParseFloat(fields[0], 64); err != nil {
+			continue
+		}
+
+		if len(fields) != 2 {
+			return Event{}, fmt.Errorf("invalid timing line: %q", r.timing.Text())
+		}
+
+		delay, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return Event{}, fmt.Errorf("invalid timing delay: %w", err)
+		}
+
+		size, err := strconv.Atoi(fields[1])
+		if err != nil || size < 0 || size > maxEventSize {
+			return Event{}, fmt.Errorf("invalid timing size: %q", fields[1])
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r.typescript, data); err != nil {
+			return Event{}, fmt.Errorf("failed to read typescript: %w", err)
+		}
+
+		r.elapsed += delay
+		return Event{Time: r.elapsed, Code: "o", Data: string(data)}, nil
+	}
+
+	if err := r.timing.Err(); err != nil {
+		return Event{}, fmt.Errorf("failed to read timing: %w", err)
+	}
+
+	return Event{}, io.EOF
+}
+
+// scriptFormat reads and writes typescripts, the timing file is next to the typescript, see TimingPath.
+type scriptFormat struct{}
+
+func (scriptFormat) Name() string {
+	return "script"
+}
+
+func (scriptFormat) Ext() string {
+	return ScriptExt
+}
+
+func (scriptFormat) Create(path string, header Header) (Recorder, error) {
+	typescript, err := createFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	timing, err := createFile(TimingPath(path))
+	if err != nil {
+		typescript.Close()
+		return nil, err
+	}
+
+	rec, err := NewScript(typescript, timing, header)
+	if err != nil {
+		typescript.Close()
+		timing.Close()
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+func (scriptFormat) Open(path string) (Reader, error) {
+	typescript, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+
+	timing, err := os.Open(TimingPath(path))
+	if err != nil {
+		typescript.Close()
+		return nil, fmt.Errorf("failed to open timing: %w", err)
+	}
+
+	reader, err := NewScriptReader(typescript, timing)
+	if err != nil {
+		typescript.Close()
+		timing.Close()
+		return nil, err
+	}
+
+	return &fileReader{eventReader: reader, Closer: closers{typescript, timing}}, nil
+}
+
+// closers closes all of its closers.
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var errs []error
+	for _, closer := range c {
+		errs = append(errs, closer.Close())
+	}
+
+	return errors.Join(errs...)
+}
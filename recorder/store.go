@@ -0,0 +1,601 @@
+package recorder
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// GzipExt is appended to the name of compressed recordings.
+	GzipExt = ".gz"
+	// MetaExt is the file extension of the metadata written next to a finished recording.
+	MetaExt = ".meta.json"
+)
+
+const defaultCleanInterval = time.Minute
+
+var ErrDiskFull = errors.New("recording disk is nearly full")
+
+// Retention limits which recordings a Store keeps, the oldest are removed first. Zero values do not limit.
+type Retention struct {
+	MaxAge time.Duration
+	// MaxSize is the most bytes all recordings take together.
+	MaxSize int64
+	// MaxUserSize is the most bytes the recordings of one user take, recordings without user count as one user.
+	MaxUserSize int64
+}
+
+type storeOptions struct {
+	format        Format
+	compress      bool
+	retention     Retention
+	minFree       uint64
+	cleanInterval time.Duration
+}
+
+type StoreOptionFunc func(*storeOptions)
+
+// WithFormat sets the format new recordings are written in, asciicast by default.
+func WithFormat(format Format) StoreOptionFunc {
+	return func(o *storeOptions) {
+		o.format = format
+	}
+}
+
+// WithCompression gzips recordings once they are finished.
+func WithCompression() StoreOptionFunc {
+	return func(o *storeOptions) {
+		o.compress = true
+	}
+}
+
+// WithRetention removes the recordings beyond the retention.
+func WithRetention(retention Retention) StoreOptionFunc {
+	return func(o *storeOptions) {
+		o.retention = retention
+	}
+}
+
+// WithMinFreeSpace stops recording while the volume of the directory has less than bytes free.
+func WithMinFreeSpace(bytes uint64) StoreOptionFunc {
+	return func(o *storeOptions) {
+		o.minFree = bytes
+	}
+}
+
+// WithCleanInterval sets how often the janitor enforces the retention and checks the free space.
+func WithCleanInterval(interval time.Duration) StoreOptionFunc {
+	return func(o *storeOptions) {
+		o.cleanInterval = interval
+	}
+}
+
+// Store keeps the recordings of a directory. Recordings with an owner are in a subdirectory
+// named after the owner, the others directly in the directory.
+type Store struct {
+	dir string
+	opt storeOptions
+	log *slog.Logger
+
+	// full is set while the volume has less free space than the minimum
+	full atomic.Bool
+	// active are the recordings being written, by their path without extension
+	active     map[string]bool
+	activeLock sync.Mutex
+	// compressLock serialises compression, a closing recording and the janitor may compress the same files
+	compressLock sync.Mutex
+
+	now       func() time.Time
+	freeSpace func(dir string) (uint64, error)
+}
+
+func NewStore(dir string, log *slog.Logger, optfs ...StoreOptionFunc) *Store {
+	opt := storeOptions{format: Asciicast, cleanInterval: defaultCleanInterval}
+	for _, optf := range optfs {
+		optf(&opt)
+	}
+
+	return &Store{
+		dir:       dir,
+		opt:       opt,
+		log:       log,
+		active:    make(map[string]bool),
+		now:       time.Now,
+		freeSpace: freeSpace,
+	}
+}
+
+// Dir returns the directory of the recordings.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Create creates the recording of the session with the sid for its owner, empty for nobody.
+// The profile the session was started with is kept in the metadata of the recording.
+// It returns ErrDiskFull while the volume is nearly full.
+func (s *Store) Create(sid string, owner string, profile string, header Header) (Recorder, error) {
+	if err := checkSid(sid); err != nil {
+		return nil, err
+	}
+
+	dir := ownerDir(s.dir, owner)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	if s.checkFreeSpace() {
+		return nil, ErrDiskFull
+	}
+
+	name := filepath.Join(dir, FileName(sid, header.Timestamp))
+	if err := writeMeta(name, meta{Profile: profile}); err != nil {
+		return nil, err
+	}
+
+	rec, err := s.opt.format.Create(name+s.opt.format.Ext(), header)
+	if err != nil {
+		return nil, err
+	}
+
+	s.activeLock.Lock()
+	s.active[name] = true
+	s.activeLock.Unlock()
+
+	return &storedRecorder{Recorder: rec, store: s, name: name, profile: profile, start: header.Timestamp}, nil
+}
+
+// ownerDir returns the directory of the recordings of owner in dir, escaped so it stays inside dir.
+func ownerDir(dir string, owner string) string {
+	if owner == "" {
+		return dir
+	}
+
+	escaped := url.PathEscape(owner)
+	if strings.Trim(escaped, ".") == "" {
+		escaped = strings.ReplaceAll(escaped, ".", "%2E")
+	}
+
+	return filepath.Join(dir, escaped)
+}
+
+// checkFreeSpace updates and returns whether the volume is nearly full.
+func (s *Store) checkFreeSpace() bool {
+	if s.opt.minFree == 0 {
+		return false
+	}
+
+	free, err := s.freeSpace(s.dir)
+	if err != nil {
+		s.log.Warn("failed to check free space of recording directory", "error", err)
+		return s.full.Load()
+	}
+
+	full := free < s.opt.minFree
+	if was := s.full.Swap(full); was != full {
+		if full {
+			s.log.Warn("recording disk is nearly full, recording is disabled", "free", free, "min_free", s.opt.minFree)
+		} else {
+			s.log.Info("recording disk has free space again, recording is enabled", "free", free)
+		}
+	}
+
+	return full
+}
+
+func freeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
+
+// Run is the janitor, it enforces the retention and checks the free space until ctx is done.
+func (s *Store) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.opt.cleanInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Clean(); err != nil {
+			s.log.Error("failed to clean recordings", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// stored is a recording in the store, made of all files whose name starts with its id.
+type stored struct {
+	// name is the path without extension
+	name    string
+	user    string
+	files   []string
+	size    int64
+	modTime time.Time
+}
+
+// Clean compresses finished recordings if compression is enabled, removes the recordings beyond the retention
+// and checks the free space. Recordings being written are never touched.
+func (s *Store) Clean() error {
+	defer s.checkFreeSpace()
+
+	recordings, err := s.scan()
+	if err != nil {
+		return err
+	}
+
+	if s.opt.compress {
+		for _, rec := range recordings {
+			if err := s.compress(rec); err != nil {
+				s.log.Warn("failed to compress recording", "recording", rec.name, "error", err)
+			}
+		}
+
+		if recordings, err = s.scan(); err != nil {
+			return err
+		}
+	}
+
+	// oldest first, so the size limits remove them first
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].modTime.Before(recordings[j].modTime)
+	})
+
+	retention := s.opt.retention
+	kept := recordings[:0]
+	for _, rec := range recordings {
+		if retention.MaxAge > 0 && s.now().Sub(rec.modTime) > retention.MaxAge && !s.isActive(rec.name) {
+			s.remove(rec, "max age")
+			continue
+		}
+
+		kept = append(kept, rec)
+	}
+
+	if retention.MaxUserSize > 0 {
+		users := make(map[string][]*stored)
+		for _, rec := range kept {
+			users[rec.user] = append(users[rec.user], rec)
+		}
+
+		kept = kept[:0]
+		for _, recs := range users {
+			kept = append(kept, s.limitSize(recs, retention.MaxUserSize, "max user size")...)
+		}
+
+		sort.Slice(kept, func(i, j int) bool {
+			return kept[i].modTime.Before(kept[j].modTime)
+		})
+	}
+
+	if retention.MaxSize > 0 {
+		s.limitSize(kept, retention.MaxSize, "max size")
+	}
+
+	return nil
+}
+
+// limitSize removes the oldest recordings until the rest takes at most max bytes and returns the rest.
+func (s *Store) limitSize(recordings []*stored, max int64, reason string) []*stored {
+	var total int64
+	for _, rec := range recordings {
+		total += rec.size
+	}
+
+	kept := make([]*stored, 0, len(recordings))
+	for _, rec := range recordings {
+		if total > max && !s.isActive(rec.name) {
+			s.remove(rec, reason)
+			total -= rec.size
+			continue
+		}
+
+		kept = append(kept, rec)
+	}
+
+	return kept
+}
+
+func (s *Store) remove(rec *stored, reason string) {
+	if s.isActive(rec.name) {
+		return
+	}
+
+	for _, file := range rec.files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			s.log.Warn("failed to remove recording", "file", file, "error", err)
+		}
+	}
+
+	s.log.Info("recording removed", "recording", rec.name, "reason", reason)
+}
+
+// compress gzips the files of a finished recording that are not compressed yet.
+func (s *Store) compress(rec *stored) error {
+	if s.isActive(rec.name) {
+		return nil
+	}
+
+	s.compressLock.Lock()
+	defer s.compressLock.Unlock()
+
+	for _, file := range rec.files {
+		if strings.HasSuffix(file, GzipExt) || strings.HasSuffix(file, MetaExt) {
+			continue
+		}
+
+		// the file is gone if it was compressed since rec was listed
+		if err := compressFile(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compressFile replaces the file with its gzipped copy of the same modification time.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + GzipExt + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	err = errors.Join(err, zw.Close(), dst.Close())
+	if err == nil {
+		err = os.Chtimes(tmp, stat.ModTime(), stat.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+GzipExt)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func (s *Store) isActive(name string) bool {
+	s.activeLock.Lock()
+	defer s.activeLock.Unlock()
+	return s.active[name]
+}
+
+func (s *Store) finish(name string) {
+	s.activeLock.Lock()
+	delete(s.active, name)
+	s.activeLock.Unlock()
+}
+
+// scan returns the recordings in the directory and the directories of the users.
+func (s *Store) scan() ([]*stored, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	byName := make(map[string]*stored)
+	var recordings []*stored
+	add := func(dir string, user string, entry os.DirEntry) {
+		id, ok := recordingFileId(entry.Name())
+		if !ok || entry.IsDir() {
+			return
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return
+		}
+
+		name := filepath.Join(dir, id)
+		rec, exist := byName[name]
+		if !exist {
+			rec = &stored{name: name, user: user}
+			byName[name] = rec
+			recordings = append(recordings, rec)
+		}
+
+		rec.files = append(rec.files, filepath.Join(dir, entry.Name()))
+		rec.size += info.Size()
+		if info.ModTime().After(rec.modTime) {
+			rec.modTime = info.ModTime()
+		}
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			add(s.dir, "", entry)
+			continue
+		}
+
+		user, err := url.PathUnescape(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		dir := filepath.Join(s.dir, entry.Name())
+		userEntries, err := os.ReadDir(dir)
+		if err != nil {
+			s.log.Warn("failed to list recordings of user", "user", user, "error", err)
+			continue
+		}
+
+		for _, userEntry := range userEntries {
+			add(dir, user, userEntry)
+		}
+	}
+
+	return recordings, nil
+}
+
+// recording returns the recording with the name, the path without extension.
+func (s *Store) recording(name string) *stored {
+	rec := &stored{name: name}
+	entries, err := os.ReadDir(filepath.Dir(name))
+	if err != nil {
+		return rec
+	}
+
+	for _, entry := range entries {
+		if id, ok := recordingFileId(entry.Name()); ok && !entry.IsDir() && id == filepath.Base(name) {
+			rec.files = append(rec.files, filepath.Join(filepath.Dir(name), entry.Name()))
+		}
+	}
+
+	return rec
+}
+
+// recordingFileId returns the id of the recording a file belongs to, if it is a recording file of any format.
+func recordingFileId(file string) (string, bool) {
+	id, ext, ok := strings.Cut(file, ".")
+	if !ok || !recordingIdPattern.MatchString(id) {
+		return "", false
+	}
+
+	ext = "." + strings.TrimSuffix(ext, GzipExt)
+	if ext == TimingExt || ext == MetaExt {
+		return id, true
+	}
+
+	for _, format := range Formats() {
+		if ext == format.Ext() {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
+// meta is what the store knows about a recording without reading it.
+type meta struct {
+	// Profile is the name of the profile the recorded session was started with.
+	Profile string `json:"profile"`
+	// Finished is true once the recording is closed, Duration is only known then.
+	Finished bool `json:"finished"`
+	// Duration is the time of the last event in seconds.
+	Duration float64 `json:"duration"`
+}
+
+// writeMeta writes the metadata of the recording with the name, the path without extension.
+func writeMeta(name string, m meta) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal recording metadata: %w", err)
+	}
+
+	if err := os.WriteFile(name+MetaExt, data, 0600); err != nil {
+		return fmt.Errorf("failed to write recording metadata: %w", err)
+	}
+
+	return nil
+}
+
+// readMeta reads the metadata of the recording with the name, false if there is none.
+func readMeta(name string) (meta, bool) {
+	data, err := os.ReadFile(name + MetaExt)
+	if err != nil {
+		return meta{}, false
+	}
+
+	var m meta
+	if err := json.Unmarshal(data, &m); err != nil {
+		return meta{}, false
+	}
+
+	return m, true
+}
+
+// storedRecorder stops writing while the volume is nearly full, and compresses the recording when it is closed.
+// It keeps the time of the last event, so the duration is known without reading the recording again.
+type storedRecorder struct {
+	Recorder
+	store   *Store
+	name    string
+	profile string
+	start   time.Time
+
+	last     time.Time
+	lastLock sync.Mutex
+}
+
+func (r *storedRecorder) WriteOutput(at time.Time, data []byte) error {
+	if r.store.full.Load() {
+		return ErrDiskFull
+	}
+
+	r.written(at)
+	return r.Recorder.WriteOutput(at, data)
+}
+
+func (r *storedRecorder) WriteResize(at time.Time, width, height int) error {
+	if r.store.full.Load() {
+		return ErrDiskFull
+	}
+
+	r.written(at)
+	return r.Recorder.WriteResize(at, width, height)
+}
+
+func (r *storedRecorder) written(at time.Time) {
+	r.lastLock.Lock()
+	defer r.lastLock.Unlock()
+
+	if at.After(r.last) {
+		r.last = at
+	}
+}
+
+func (r *storedRecorder) Close() error {
+	err := r.Recorder.Close()
+
+	r.lastLock.Lock()
+	duration := max(r.last.Sub(r.start).Seconds(), 0)
+	r.lastLock.Unlock()
+
+	// written while the recording is still active, so a finished recording always has its metadata
+	err = errors.Join(err, writeMeta(r.name, meta{Profile: r.profile, Finished: true, Duration: duration}))
+	r.store.finish(r.name)
+
+	if r.store.opt.compress {
+		err = errors.Join(err, r.store.compress(r.store.recording(r.name)))
+	}
+
+	return err
+}
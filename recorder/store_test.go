@@ -0,0 +1,198 @@
+package recorder
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestStore(dir string, optfs ...StoreOptionFunc) *Store {
+	return NewStore(dir, slog.New(slog.NewTextHandler(io.Discard, nil)), optfs...)
+}
+
+// writeRecording writes a recording file of size bytes, last modified at modTime.
+func writeRecording(t *testing.T, path string, size int, modTime time.Time) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	assert.NoError(t, os.WriteFile(path, make([]byte, size), 0600))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestStore_Create(t *testing.T) {
+	t.Run("test Create() compressed", func(t *testing.T) {
+		dir := t.TempDir()
+		store := newTestStore(dir, WithCompression())
+		start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+		rec, err := store.Create("abc", "alice", "default", Header{Width: 80, Height: 24, Timestamp: start, Title: "default"})
+		assert.NoError(t, err)
+		assert.NoError(t, rec.WriteOutput(start.Add(2*time.Second), []byte("hello")))
+		assert.NoError(t, rec.Close())
+
+		assert.False(t, exists(filepath.Join(dir, "alice", "abc-20240501T100000Z.cast")))
+		assert.True(t, exists(filepath.Join(dir, "alice", "abc-20240501T100000Z.cast.gz")))
+		assert.True(t, exists(filepath.Join(dir, "alice", "abc-20240501T100000Z"+MetaExt)))
+
+		infos, err := List(dir)
+		assert.NoError(t, err)
+		assert.Len(t, infos, 1)
+		assert.Equal(t, "abc-20240501T100000Z", infos[0].Id)
+		assert.Equal(t, "alice", infos[0].User)
+		assert.Equal(t, "default", infos[0].Profile)
+		assert.Equal(t, 2.0, infos[0].Duration)
+
+		file, err := Open(dir, "alice", "abc-20240501T100000Z")
+		assert.NoError(t, err)
+		data, err := io.ReadAll(file)
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+		assert.Contains(t, string(data), `[2,"o","hello"]`)
+	})
+
+	t.Run("test Create() disk full", func(t *testing.T) {
+		free := uint64(1 << 30)
+		store := newTestStore(t.TempDir(), WithMinFreeSpace(100<<20))
+		store.freeSpace = func(string) (uint64, error) { return free, nil }
+
+		rec, err := store.Create("abc", "", "", Header{Timestamp: time.Now()})
+		assert.NoError(t, err)
+
+		free = 10 << 20
+		_, err = store.Create("def", "", "", Header{Timestamp: time.Now()})
+		assert.ErrorIs(t, err, ErrDiskFull)
+		assert.ErrorIs(t, rec.WriteOutput(time.Now(), []byte("hello")), ErrDiskFull)
+		assert.NoError(t, rec.Close())
+
+		free = 1 << 30
+		assert.NoError(t, store.Clean())
+		_, err = store.Create("def", "", "", Header{Timestamp: time.Now()})
+		assert.NoError(t, err)
+	})
+
+	t.Run("test Create() invalid sid", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "recordings")
+		store := newTestStore(dir)
+
+		for _, sid := range []string{"../../x", "a/b", "", ".."} {
+			_, err := store.Create(sid, "", "", Header{Timestamp: time.Now()})
+			assert.ErrorIs(t, err, ErrInvalidSid, sid)
+		}
+
+		entries, _ := os.ReadDir(filepath.Dir(dir))
+		assert.Len(t, entries, 0)
+	})
+
+	t.Run("test ownerDir()", func(t *testing.T) {
+		assert.Equal(t, "/recordings", ownerDir("/recordings", ""))
+		assert.Equal(t, "/recordings/bob@example.com", ownerDir("/recordings", "bob@example.com"))
+		assert.Equal(t, "/recordings/..%2Fetc", ownerDir("/recordings", "../etc"))
+		assert.Equal(t, "/recordings/%2E%2E", ownerDir("/recordings", ".."))
+	})
+}
+
+func TestStore_Clean(t *testing.T) {
+	now := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	t.Run("test max age", func(t *testing.T) {
+		dir := t.TempDir()
+		store := newTestStore(dir, WithRetention(Retention{MaxAge: 7 * day}))
+		store.now = func() time.Time { return now }
+
+		writeRecording(t, filepath.Join(dir, "old-20240501T000000Z.typescript"), 10, now.Add(-8*day))
+		writeRecording(t, filepath.Join(dir, "old-20240501T000000Z.timing"), 10, now.Add(-8*day))
+		writeRecording(t, filepath.Join(dir, "old-20240501T000000Z.input.jsonl"), 10, now.Add(-8*day))
+		writeRecording(t, filepath.Join(dir, "new-20240509T000000Z.cast"), 10, now.Add(-day))
+
+		assert.NoError(t, store.Clean())
+		assert.False(t, exists(filepath.Join(dir, "old-20240501T000000Z.typescript")))
+		assert.False(t, exists(filepath.Join(dir, "old-20240501T000000Z.timing")))
+		assert.True(t, exists(filepath.Join(dir, "old-20240501T000000Z.input.jsonl")))
+		assert.True(t, exists(filepath.Join(dir, "new-20240509T000000Z.cast")))
+	})
+
+	t.Run("test max size", func(t *testing.T) {
+		dir := t.TempDir()
+		store := newTestStore(dir, WithRetention(Retention{MaxSize: 250, MaxUserSize: 150}))
+
+		writeRecording(t, filepath.Join(dir, "alice", "a1-20240501T000000Z.cast"), 100, now.Add(-5*day))
+		writeRecording(t, filepath.Join(dir, "alice", "a2-20240502T000000Z.cast"), 100, now.Add(-4*day))
+		writeRecording(t, filepath.Join(dir, "bob", "b1-20240503T000000Z.cast"), 100, now.Add(-3*day))
+		writeRecording(t, filepath.Join(dir, "c1-20240504T000000Z.ttyrec"), 100, now.Add(-2*day))
+		writeRecording(t, filepath.Join(dir, "c2-20240505T000000Z.ttyrec"), 10, now.Add(-day))
+
+		assert.NoError(t, store.Clean())
+
+		var left []string
+		for _, path := range []string{
+			"alice/a1-20240501T000000Z.cast", "alice/a2-20240502T000000Z.cast", "bob/b1-20240503T000000Z.cast",
+			"c1-20240504T000000Z.ttyrec", "c2-20240505T000000Z.ttyrec",
+		} {
+			if exists(filepath.Join(dir, path)) {
+				left = append(left, path)
+			}
+		}
+
+		// alice is over the user limit, then the oldest go until all fit
+		assert.Equal(t, []string{"bob/b1-20240503T000000Z.cast", "c1-20240504T000000Z.ttyrec", "c2-20240505T000000Z.ttyrec"}, left)
+	})
+
+	t.Run("test active recording", func(t *testing.T) {
+		dir := t.TempDir()
+		store := newTestStore(dir, WithRetention(Retention{MaxSize: 1}), WithCompression())
+
+		rec, err := store.Create("abc", "", "", Header{Timestamp: now})
+		assert.NoError(t, err)
+		assert.NoError(t, rec.WriteOutput(now, []byte(strings.Repeat("a", 100))))
+
+		assert.NoError(t, store.Clean())
+		assert.True(t, exists(filepath.Join(dir, "abc-20240510T000000Z.cast")))
+
+		assert.NoError(t, rec.Close())
+		assert.True(t, exists(filepath.Join(dir, "abc-20240510T000000Z.cast.gz")))
+
+		assert.NoError(t, store.Clean())
+		assert.False(t, exists(filepath.Join(dir, "abc-20240510T000000Z.cast.gz")))
+	})
+
+	t.Run("test compress concurrently", func(t *testing.T) {
+		dir := t.TempDir()
+		store := newTestStore(dir, WithCompression())
+
+		name := filepath.Join(dir, "abc-20240510T000000Z")
+		content := strings.Repeat("output\n", 100000)
+		assert.NoError(t, os.WriteFile(name+".typescript", []byte(content), 0600))
+		assert.NoError(t, os.WriteFile(name+".timing", []byte("0.1 7\n"), 0600))
+
+		// a closing recording and the janitor both compress the same files
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, store.compress(store.recording(name)))
+			}()
+		}
+		wg.Wait()
+
+		assert.False(t, exists(name+".typescript"))
+		assert.False(t, exists(name+".typescript.gz.tmp"))
+
+		file, err := openCast(name + ".typescript.gz")
+		assert.NoError(t, err)
+		data, err := io.ReadAll(file)
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+		assert.Equal(t, content, string(data))
+	})
+}
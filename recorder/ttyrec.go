@@ -0,0 +1,167 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// TtyrecExt is the file extension of ttyrec recordings.
+const TtyrecExt = ".ttyrec"
+
+// ttyrecHeaderSize is the size of the header of a ttyrec record: seconds, microseconds and length, little endian.
+const ttyrecHeaderSize = 12
+
+// ttyrec writes a ttyrec recording: every output is a record of its time and data.
+// ttyrec has no size changes, they are not recorded.
+type ttyrec struct {
+	lock sync.Mutex
+	w    io.WriteCloser
+}
+
+func NewTtyrec(w io.WriteCloser) Recorder {
+	return &ttyrec{w: w}
+}
+
+func (t *ttyrec) WriteOutput(at time.Time, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	var header [ttyrecHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:], uint32(at.Unix()))
+	binary.LittleEndian.PutUint32(header[4:], uint32(at.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(data)))
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, err := t.w.Write(append(header[:], data...)); err != nil {
+		return fmt.Errorf("failed to write ttyrec record: %w", err)
+	}
+
+	return nil
+}
+
+func (t *ttyrec) WriteResize(at time.Time, width, height int) error {
+	return nil
+}
+
+func (t *ttyrec) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.w.Close()
+}
+
+// TtyrecReader reads the records of a ttyrec recording as output events.
+type TtyrecReader struct {
+	r      *bufio.Reader
+	header Header
+	// first is the first record, read ahead to know when the recording started
+	first *ttyrecRecord
+}
+
+type ttyrecRecord struct {
+	at   time.Time
+	data []byte
+}
+
+func NewTtyrecReader(r io.Reader) (*TtyrecReader, error) {
+	reader := &TtyrecReader{r: bufio.NewReader(r)}
+
+	first, err := reader.read()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if first != nil {
+		reader.first = first
+		reader.header.Timestamp = first.at
+	}
+
+	return reader, nil
+}
+
+// Header returns the start of the recording, ttyrec does not store the size.
+func (r *TtyrecReader) Header() Header {
+	return r.header
+}
+
+func (r *TtyrecReader) Next() (Event, error) {
+	record := r.first
+	r.first = nil
+
+	if record == nil {
+		var err error
+		if record, err = r.read(); err != nil {
+			return Event{}, err
+		}
+	}
+
+	return Event{Time: record.at.Sub(r.header.Timestamp).Seconds(), Code: "o", Data: string(record.data)}, nil
+}
+
+func (r *TtyrecReader) read() (*ttyrecRecord, error) {
+	var header [ttyrecHeaderSize]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+
+		return nil, fmt.Errorf("failed to read ttyrec record header: %w", err)
+	}
+
+	size := binary.LittleEndian.Uint32(header[8:])
+	if size > maxEventSize {
+		return nil, fmt.Errorf("ttyrec record of %d bytes is too large", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, fmt.Errorf("failed to read ttyrec record: %w", err)
+	}
+
+	sec := binary.LittleEndian.Uint32(header[0:])
+	usec := binary.LittleEndian.Uint32(header[4:])
+	return &ttyrecRecord{at: time.Unix(int64(sec), int64(usec)*1000), data: data}, nil
+}
+
+// ttyrecFormat reads and writes ttyrec recordings.
+type ttyrecFormat struct{}
+
+func (ttyrecFormat) Name() string {
+	return "ttyrec"
+}
+
+func (ttyrecFormat) Ext() string {
+	return TtyrecExt
+}
+
+func (ttyrecFormat) Create(path string, header Header) (Recorder, error) {
+	file, err := createFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTtyrec(file), nil
+}
+
+func (ttyrecFormat) Open(path string) (Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+
+	reader, err := NewTtyrecReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &fileReader{eventReader: reader, Closer: file}, nil
+}
@@ -0,0 +1,203 @@
+package session
+
+import (
+	"bytes"
+	"encoding/base64"
+	"time"
+)
+
+type ClipboardMode string
+
+const (
+	// ClipboardAllow passes clipboard writes and queries through to the client.
+	ClipboardAllow ClipboardMode = "allow"
+	// ClipboardDeny strips every OSC 52 sequence from the output.
+	ClipboardDeny ClipboardMode = "deny"
+	// ClipboardWriteOnly lets the session set the clipboard but never read it.
+	ClipboardWriteOnly ClipboardMode = "allow-write-only"
+)
+
+const (
+	// maxClipboardEvents is how many forwarded clipboard writes a session keeps for slow readers.
+	maxClipboardEvents = 16
+	// maxClipboardSequence is the longest OSC 52 sequence the filter holds back, a longer one is dropped.
+	maxClipboardSequence = 1 << 20
+	// clipboardFlushDelay is how long an unfinished OSC 52 sequence is held back when no output follows.
+	clipboardFlushDelay = 100 * time.Millisecond
+)
+
+var oscClipboardPrefix = []byte("\x1b]52;")
+
+// ClipboardPolicy controls what happens to OSC 52 clipboard sequences in the session output.
+type ClipboardPolicy struct {
+	Mode ClipboardMode `json:"mode"`
+	// MaxSize is the largest clipboard content in bytes that may be written, 0 means unlimited.
+	MaxSize int `json:"max_size"`
+	// Forward strips allowed clipboard writes from the output and hands them out as ClipboardEvent instead.
+	Forward bool `json:"forward"`
+}
+
+// passthrough returns true if the policy never changes the output.
+func (p ClipboardPolicy) passthrough() bool {
+	return (p.Mode == "" || p.Mode == ClipboardAllow) && p.MaxSize == 0 && !p.Forward
+}
+
+// allowRead returns true if the session may query the clipboard.
+func (p ClipboardPolicy) allowRead() bool {
+	return p.Mode == "" || p.Mode == ClipboardAllow
+}
+
+// ClipboardEvent is a clipboard write forwarded out of band.
+type ClipboardEvent struct {
+	Seq       uint64
+	Selection string
+	// Data is the base64 encoded clipboard content.
+	Data string
+}
+
+type clipboardState int
+
+const (
+	clipboardGround clipboardState = iota
+	clipboardPrefix
+	clipboardPayload
+	clipboardPayloadEscape
+)
+
+// clipboardFilter applies a ClipboardPolicy to the output stream.
+// Sequences may be split across reads, so a possible OSC 52 sequence is held back until it is complete.
+type clipboardFilter struct {
+	policy ClipboardPolicy
+	state  clipboardState
+	held   []byte
+	handle func(ClipboardEvent)
+}
+
+func newClipboardFilter(policy ClipboardPolicy, handle func(ClipboardEvent)) *clipboardFilter {
+	return &clipboardFilter{policy: policy, handle: handle}
+}
+
+// Filter returns data with the clipboard sequences handled according to the policy.
+func (f *clipboardFilter) Filter(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+
+	for _, c := range data {
+		switch f.state {
+		case clipboardGround:
+			if c == esc {
+				f.held = append(f.held[:0], c)
+				f.state = clipboardPrefix
+				continue
+			}
+
+			out = append(out, c)
+		case clipboardPrefix:
+			f.held = append(f.held, c)
+			if !bytes.HasPrefix(oscClipboardPrefix, f.held) {
+				// not a clipboard sequence, release what was held back
+				out = append(out, f.held...)
+				f.state = clipboardGround
+				if c == esc {
+					out = out[:len(out)-1]
+					f.held = append(f.held[:0], c)
+					f.state = clipboardPrefix
+				}
+				continue
+			}
+
+			if len(f.held) == len(oscClipboardPrefix) {
+				f.state = clipboardPayload
+			}
+		case clipboardPayload:
+			switch c {
+			case bel:
+				out = f.finish(out, []byte{bel})
+			case esc:
+				f.state = clipboardPayloadEscape
+			default:
+				f.hold(c)
+			}
+		case clipboardPayloadEscape:
+			if c == '\\' {
+				out = f.finish(out, []byte{esc, '\\'})
+				continue
+			}
+
+			// any other escape aborts the sequence, the terminal would ignore it as well
+			f.held = append(f.held[:0], esc)
+			f.state = clipboardPrefix
+			out = append(out, f.Filter([]byte{c})...)
+		}
+	}
+
+	return out
+}
+
+// Pending returns true if the output ends in what could be the start of an OSC 52 sequence, e.g. a lone ESC,
+// or in a sequence that is not finished yet.
+func (f *clipboardFilter) Pending() bool {
+	return f.state != clipboardGround
+}
+
+// Flush releases the start of a possible OSC 52 sequence held back at the end of the output and drops
+// an unfinished one. Programs write a clipboard sequence at once, when no more output follows the start
+// is not one and an unfinished sequence never gets finished, the output after it must not be swallowed.
+func (f *clipboardFilter) Flush() []byte {
+	state := f.state
+	f.state = clipboardGround
+	if state != clipboardPrefix {
+		f.held = f.held[:0]
+		return nil
+	}
+
+	out := append([]byte{}, f.held...)
+	f.held = f.held[:0]
+	return out
+}
+
+// hold holds back a byte of the sequence, a sequence too long for a clipboard write is dropped
+// and the output after it passes through again.
+func (f *clipboardFilter) hold(c byte) {
+	if len(f.held) >= maxClipboardSequence {
+		f.held = f.held[:0]
+		f.state = clipboardGround
+		return
+	}
+
+	f.held = append(f.held, c)
+}
+
+// finish decides what to do with a complete sequence and appends what should be kept to out.
+func (f *clipboardFilter) finish(out []byte, terminator []byte) []byte {
+	f.state = clipboardGround
+	selection, content, _ := bytes.Cut(f.held[len(oscClipboardPrefix):], []byte{';'})
+
+	if string(content) == "?" {
+		// a query asks the terminal to report the clipboard, it can not be answered out of band
+		if !f.policy.allowRead() || f.policy.Forward {
+			return out
+		}
+
+		out = append(out, f.held...)
+		return append(out, terminator...)
+	}
+
+	if f.policy.Mode == ClipboardDeny {
+		return out
+	}
+
+	if f.policy.MaxSize > 0 {
+		decoded, err := base64.StdEncoding.DecodeString(string(content))
+		if err != nil || len(decoded) > f.policy.MaxSize {
+			return out
+		}
+	}
+
+	if f.policy.Forward {
+		f.handle(ClipboardEvent{Selection: string(selection), Data: string(content)})
+		return out
+	}
+
+	out = append(out, f.held...)
+	return append(out, terminator...)
+}
@@ -0,0 +1,107 @@
+package session
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestClipboardFilter(t *testing.T) {
+	const (
+		write = "\x1b]52;c;aGVsbG8=\x07"
+		query = "\x1b]52;c;?\x1b\\"
+		other = "\x1b]0;title\x07\x1b[0m"
+	)
+
+	filter := func(policy ClipboardPolicy, chunks ...string) (string, []ClipboardEvent) {
+		var events []ClipboardEvent
+		f := newClipboardFilter(policy, func(event ClipboardEvent) {
+			events = append(events, event)
+		})
+
+		out := ""
+		for _, chunk := range chunks {
+			out += string(f.Filter([]byte(chunk)))
+		}
+
+		return out, events
+	}
+
+	t.Run("test allow", func(t *testing.T) {
+		out, events := filter(ClipboardPolicy{Mode: ClipboardAllow, MaxSize: 10}, "a"+write+"b"+query+other)
+		assert.Equal(t, "a"+write+"b"+query+other, out)
+		assert.Empty(t, events)
+	})
+
+	t.Run("test deny", func(t *testing.T) {
+		out, _ := filter(ClipboardPolicy{Mode: ClipboardDeny}, "a"+write+"b"+query+other)
+		assert.Equal(t, "ab"+other, out)
+	})
+
+	t.Run("test allow-write-only", func(t *testing.T) {
+		out, _ := filter(ClipboardPolicy{Mode: ClipboardWriteOnly}, "a"+write+"b"+query+other)
+		assert.Equal(t, "a"+write+"b"+other, out)
+	})
+
+	t.Run("test max size", func(t *testing.T) {
+		out, _ := filter(ClipboardPolicy{Mode: ClipboardAllow, MaxSize: 4}, "a"+write+"b")
+		assert.Equal(t, "ab", out)
+	})
+
+	t.Run("test forward", func(t *testing.T) {
+		out, events := filter(ClipboardPolicy{Mode: ClipboardAllow, Forward: true}, "a"+write+"b"+query)
+		assert.Equal(t, "ab", out)
+		assert.Equal(t, []ClipboardEvent{{Selection: "c", Data: "aGVsbG8="}}, events)
+	})
+
+	t.Run("test split sequence", func(t *testing.T) {
+		out, events := filter(ClipboardPolicy{Mode: ClipboardAllow, Forward: true}, "a\x1b", "]5", "2;c;aGV", "sbG8=\x1b", "\\b")
+		assert.Equal(t, "ab", out)
+		assert.Equal(t, []ClipboardEvent{{Selection: "c", Data: "aGVsbG8="}}, events)
+	})
+
+	t.Run("test escape sequences pass through", func(t *testing.T) {
+		out, _ := filter(ClipboardPolicy{Mode: ClipboardDeny}, "\x1b\x1b[1m", "\x1b]", "5", "1;x\x07")
+		assert.Equal(t, "\x1b\x1b[1m\x1b]51;x\x07", out)
+	})
+
+	t.Run("test aborted sequence", func(t *testing.T) {
+		out, _ := filter(ClipboardPolicy{Mode: ClipboardAllow, MaxSize: 10}, "\x1b]52;c;aGV\x1b[0m")
+		assert.Equal(t, "\x1b[0m", out)
+	})
+
+	t.Run("test oversized sequence", func(t *testing.T) {
+		f := newClipboardFilter(ClipboardPolicy{Mode: ClipboardDeny}, nil)
+		out := string(f.Filter([]byte("a\x1b]52;c;" + strings.Repeat("A", maxClipboardSequence))))
+		assert.False(t, f.Pending())
+
+		out += string(f.Filter([]byte("\x07after")))
+		assert.True(t, strings.HasPrefix(out, "a"), out)
+		assert.True(t, strings.HasSuffix(out, "after"), out)
+		assert.Less(t, len(out), 16)
+	})
+
+	t.Run("test Flush()", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			output   string
+			filtered string
+			pending  bool
+			flushed  string
+		}{
+			{"escape", "a\x1b", "a", true, "\x1b"},
+			{"prefix", "a\x1b]5", "a", true, "\x1b]5"},
+			{"nothing held", "a\x1b[0m", "a\x1b[0m", false, ""},
+			{"payload is dropped", "a\x1b]52;c;aGV", "a", true, ""},
+			{"payload escape is dropped", "a\x1b]52;c;aGV\x1b", "a", true, ""},
+		}
+
+		for _, tt := range tests {
+			f := newClipboardFilter(ClipboardPolicy{Mode: ClipboardDeny}, nil)
+			assert.Equal(t, tt.filtered, string(f.Filter([]byte(tt.output))), tt.name)
+			assert.Equal(t, tt.pending, f.Pending(), tt.name)
+			assert.Equal(t, tt.flushed, string(f.Flush()), tt.name)
+			assert.False(t, f.Pending(), tt.name)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package session
+
+const defaultHistorySize = 1 << 20
+
+// history keeps a bounded window of the most recent session output.
+// Every byte is addressed by its absolute offset from the start of the stream,
+// so readers can resume exactly where they stopped as long as the data is still retained.
+type history struct {
+	limit int
+	data  []byte
+	start int64
+}
+
+func newHistory(limit int) *history {
+	if limit <= 0 {
+		limit = defaultHistorySize
+	}
+
+	return &history{limit: limit}
+}
+
+// Start returns the offset of the oldest retained byte.
+func (h *history) Start() int64 {
+	return h.start
+}
+
+// End returns the offset just past the newest byte.
+func (h *history) End() int64 {
+	return h.start + int64(len(h.data))
+}
+
+// Write appends p to the history, dropping the oldest bytes beyond the limit.
+func (h *history) Write(p []byte) {
+	h.data = append(h.data, p...)
+
+	if drop := len(h.data) - h.limit; drop > 0 {
+		h.data = h.data[drop:]
+		h.start += int64(drop)
+	}
+}
+
+// ReadAt returns a copy of at most max bytes starting at offset.
+// If offset is no longer retained, the data starts at the oldest retained byte instead,
+// and the returned offset tells the caller where it actually starts.
+func (h *history) ReadAt(offset int64, max int) ([]byte, int64) {
+	if offset < h.start || offset > h.End() {
+		offset = h.start
+	}
+
+	data := h.data[offset-h.start:]
+	if max > 0 && len(data) > max {
+		data = data[:max]
+	}
+
+	return append([]byte(nil), data...), offset
+}
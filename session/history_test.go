@@ -0,0 +1,50 @@
+package session
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	t.Run("test ReadAt()", func(t *testing.T) {
+		h := newHistory(8)
+		h.Write([]byte("hello"))
+
+		data, offset := h.ReadAt(0, 0)
+		assert.Equal(t, "hello", string(data))
+		assert.Equal(t, int64(0), offset)
+
+		data, offset = h.ReadAt(2, 2)
+		assert.Equal(t, "ll", string(data))
+		assert.Equal(t, int64(2), offset)
+
+		data, offset = h.ReadAt(5, 0)
+		assert.Empty(t, data)
+		assert.Equal(t, int64(5), offset)
+	})
+
+	t.Run("test drop oldest", func(t *testing.T) {
+		h := newHistory(8)
+		h.Write([]byte("hello "))
+		h.Write([]byte("world"))
+		assert.Equal(t, int64(3), h.Start())
+		assert.Equal(t, int64(11), h.End())
+
+		data, offset := h.ReadAt(6, 0)
+		assert.Equal(t, "world", string(data))
+		assert.Equal(t, int64(6), offset)
+
+		data, offset = h.ReadAt(1, 0)
+		assert.Equal(t, "lo world", string(data))
+		assert.Equal(t, int64(3), offset)
+	})
+
+	t.Run("test offset ahead of stream", func(t *testing.T) {
+		h := newHistory(8)
+		h.Write([]byte("hello"))
+
+		data, offset := h.ReadAt(10, 0)
+		assert.Equal(t, "hello", string(data))
+		assert.Equal(t, int64(0), offset)
+	})
+}
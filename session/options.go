@@ -1,19 +1,32 @@
 package session
 
 import (
+	"github.com/siriusa51/webtty/audit"
 	"log/slog"
 	"os"
 )
 
 type options struct {
-	logHandler slog.Handler
+	logHandler  slog.Handler
+	historySize int
+	maxSessions int
+	profile     string
+	owner       string
+	user        string
+	command     string
+	clipboard   ClipboardPolicy
+	audit       audit.Sink
+	recorder    NewRecorderFunc
+	inputLog    NewInputLogFunc
 }
 
 type OptionFunc func(*options)
 
 func newOptions(optfs ...OptionFunc) *options {
 	opt := &options{
-		logHandler: slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}),
+		logHandler:  slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}),
+		historySize: defaultHistorySize,
+		audit:       audit.Discard,
 	}
 
 	for _, optf := range optfs {
@@ -29,3 +42,66 @@ func WithLogHandler(logHandler slog.Handler) OptionFunc {
 		o.logHandler = logHandler
 	}
 }
+
+// WithHistorySize sets how many bytes of recent output each session retains for reconnecting clients.
+func WithHistorySize(size int) OptionFunc {
+	return func(o *options) {
+		o.historySize = size
+	}
+}
+
+// WithMaxSessions limits how many sessions the manager keeps at once, 0 means unlimited.
+func WithMaxSessions(max int) OptionFunc {
+	return func(o *options) {
+		o.maxSessions = max
+	}
+}
+
+// WithProfile sets the name of the profile the session was started with.
+func WithProfile(profile string) OptionFunc {
+	return func(o *options) {
+		o.profile = profile
+	}
+}
+
+// WithClipboardPolicy sets how the session handles OSC 52 clipboard sequences in its output.
+func WithClipboardPolicy(policy ClipboardPolicy) OptionFunc {
+	return func(o *options) {
+		o.clipboard = policy
+	}
+}
+
+// WithUser sets the authenticated user who created the session, it is reported in audit events.
+func WithUser(user string) OptionFunc {
+	return func(o *options) {
+		o.user = user
+	}
+}
+
+// WithCommand sets the command the session runs, it is reported in audit events.
+func WithCommand(command string) OptionFunc {
+	return func(o *options) {
+		o.command = command
+	}
+}
+
+// WithAuditSink sets where the session reports that its process exited.
+func WithAuditSink(sink audit.Sink) OptionFunc {
+	return func(o *options) {
+		o.audit = sink
+	}
+}
+
+// WithRecorder records the output and the size changes of the session with the recorder f creates.
+func WithRecorder(f NewRecorderFunc) OptionFunc {
+	return func(o *options) {
+		o.recorder = f
+	}
+}
+
+// WithInputLog logs the input typed into the session to the input log f creates.
+func WithInputLog(f NewInputLogFunc) OptionFunc {
+	return func(o *options) {
+		o.inputLog = f
+	}
+}
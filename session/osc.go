@@ -0,0 +1,106 @@
+package session
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+)
+
+const (
+	esc = 0x1b
+	bel = 0x07
+
+	// maxOSCSize is the longest OSC sequence the parser collects, longer ones are ignored.
+	maxOSCSize = 4096
+)
+
+type oscState int
+
+const (
+	oscGround oscState = iota
+	oscEscape
+	oscString
+	oscStringEscape
+)
+
+// oscParser finds OSC (operating system command) sequences in the output stream.
+// Sequences may be split across reads, so the parser keeps its state between calls.
+type oscParser struct {
+	state    oscState
+	buff     []byte
+	overflow bool
+}
+
+// Feed parses data and calls handle with the command number and payload of every complete sequence.
+func (p *oscParser) Feed(data []byte, handle func(cmd string, payload []byte)) {
+	for _, c := range data {
+		switch p.state {
+		case oscGround:
+			if c == esc {
+				p.state = oscEscape
+			}
+		case oscEscape:
+			switch c {
+			case ']':
+				p.state = oscString
+				p.buff = p.buff[:0]
+				p.overflow = false
+			case esc:
+			default:
+				p.state = oscGround
+			}
+		case oscString:
+			switch c {
+			case bel:
+				p.finish(handle)
+			case esc:
+				p.state = oscStringEscape
+			default:
+				p.collect(c)
+			}
+		case oscStringEscape:
+			if c == '\\' {
+				p.finish(handle)
+				continue
+			}
+
+			// any other escape aborts the sequence and starts a new one
+			p.state = oscGround
+			p.Feed([]byte{esc, c}, handle)
+		}
+	}
+}
+
+func (p *oscParser) collect(c byte) {
+	if len(p.buff) >= maxOSCSize {
+		p.overflow = true
+		return
+	}
+
+	p.buff = append(p.buff, c)
+}
+
+func (p *oscParser) finish(handle func(cmd string, payload []byte)) {
+	p.state = oscGround
+	if p.overflow {
+		return
+	}
+
+	cmd, payload, _ := bytes.Cut(p.buff, []byte{';'})
+	handle(string(cmd), payload)
+}
+
+// parseOSC7 returns the path of an OSC 7 payload, which is a file URL like file://host/path.
+func parseOSC7(payload []byte) (string, bool) {
+	u, err := url.Parse(string(payload))
+	if err != nil || u.Scheme != "file" || u.Path == "" {
+		return "", false
+	}
+
+	return u.Path, true
+}
+
+// sanitizeOSCText makes a title safe to forward in a websocket text frame.
+func sanitizeOSCText(payload []byte) string {
+	return strings.ToValidUTF8(string(payload), "�")
+}
@@ -0,0 +1,57 @@
+package session
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOSCParser(t *testing.T) {
+	collect := func(p *oscParser, data string) [][2]string {
+		var res [][2]string
+		p.Feed([]byte(data), func(cmd string, payload []byte) {
+			res = append(res, [2]string{cmd, string(payload)})
+		})
+		return res
+	}
+
+	t.Run("test BEL and ST terminators", func(t *testing.T) {
+		p := &oscParser{}
+		res := collect(p, "hello\x1b]0;vim main.go\x07world\x1b]7;file://host/tmp\x1b\\")
+		assert.Equal(t, [][2]string{{"0", "vim main.go"}, {"7", "file://host/tmp"}}, res)
+	})
+
+	t.Run("test split sequence", func(t *testing.T) {
+		p := &oscParser{}
+		assert.Empty(t, collect(p, "\x1b]2;ti"))
+		assert.Empty(t, collect(p, "tle\x1b"))
+		assert.Equal(t, [][2]string{{"2", "title"}}, collect(p, "\\"))
+	})
+
+	t.Run("test aborted sequence", func(t *testing.T) {
+		p := &oscParser{}
+		res := collect(p, "\x1b]0;broken\x1b[0m\x1b]0;ok\x07")
+		assert.Equal(t, [][2]string{{"0", "ok"}}, res)
+	})
+
+	t.Run("test oversized sequence", func(t *testing.T) {
+		p := &oscParser{}
+		data := make([]byte, maxOSCSize+1)
+		for i := range data {
+			data[i] = 'a'
+		}
+
+		assert.Empty(t, collect(p, "\x1b]0;"+string(data)+"\x07"))
+		assert.Equal(t, [][2]string{{"0", "ok"}}, collect(p, "\x1b]0;ok\x07"))
+	})
+}
+
+func TestParseOSC7(t *testing.T) {
+	t.Run("test parseOSC7()", func(t *testing.T) {
+		cwd, ok := parseOSC7([]byte("file://host/home/user/my%20app"))
+		assert.True(t, ok)
+		assert.Equal(t, "/home/user/my app", cwd)
+
+		_, ok = parseOSC7([]byte("http://host/path"))
+		assert.False(t, ok)
+	})
+}
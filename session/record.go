@@ -0,0 +1,149 @@
+package session
+
+import (
+	"github.com/siriusa51/webtty/recorder"
+	"time"
+)
+
+// NewRecorderFunc creates the recorder of the session with the id, started at start.
+type NewRecorderFunc func(id string, start time.Time) (recorder.Recorder, error)
+
+// NewInputLogFunc creates the input log of the session with the id, started at start.
+type NewInputLogFunc func(id string, start time.Time) (*recorder.InputLog, error)
+
+// startRecording creates the recorder and the input log if the session has them.
+func (s *Session) startRecording() {
+	start := time.Now()
+
+	s.recordLock.Lock()
+	defer s.recordLock.Unlock()
+
+	if s.newRecorder != nil {
+		if rec, err := s.newRecorder(s.id, start); err != nil {
+			s.log.Error("failed to start recording", "error", err)
+			s.recordErr = err
+		} else {
+			s.recorder = rec
+			s.log.Info("recording started")
+		}
+	}
+
+	if s.newInputLog != nil {
+		if inputLog, err := s.newInputLog(s.id, start); err != nil {
+			s.log.Error("failed to start input log", "error", err)
+		} else {
+			s.inputLog = inputLog
+		}
+	}
+}
+
+// RecordingError returns why the session is not recorded although it should be, nil otherwise.
+func (s *Session) RecordingError() error {
+	s.recordLock.Lock()
+	defer s.recordLock.Unlock()
+	return s.recordErr
+}
+
+// LogInput writes input the user typed to the input log. While the terminal reads a secret,
+// e.g. at a password prompt, only the fact that something was typed is logged.
+func (s *Session) LogInput(user string, data []byte) {
+	s.recordLock.Lock()
+	defer s.recordLock.Unlock()
+
+	if s.inputLog == nil {
+		return
+	}
+
+	entry := recorder.InputEntry{Time: time.Now(), User: user}
+	if s.readingSecret() {
+		entry.Redacted = true
+	} else {
+		entry.Data = string(data)
+	}
+
+	if err := s.inputLog.Write(entry); err != nil {
+		s.log.Error("failed to log input, input log stopped", "error", err)
+		s.closeInputLog()
+	}
+}
+
+// readingSecret returns true if the terminal may be reading a secret, an unknown state counts as such.
+func (s *Session) readingSecret() bool {
+	detector, ok := s.sio.(SecretDetector)
+	if !ok {
+		return false
+	}
+
+	secret, err := detector.ReadingSecret()
+	if err != nil {
+		s.log.Warn("failed to check whether the terminal reads a secret", "error", err)
+		return true
+	}
+
+	return secret
+}
+
+// recordOutput writes output to the recording, a failing recording is stopped.
+func (s *Session) recordOutput(data []byte) {
+	s.recordLock.Lock()
+	defer s.recordLock.Unlock()
+
+	if s.recorder == nil {
+		return
+	}
+
+	if err := s.recorder.WriteOutput(time.Now(), data); err != nil {
+		s.log.Error("failed to record output, recording stopped", "error", err)
+		s.recordErr = err
+		s.closeRecorder()
+	}
+}
+
+// recordResize writes a size change to the recording.
+func (s *Session) recordResize(width, height int) {
+	s.recordLock.Lock()
+	defer s.recordLock.Unlock()
+
+	if s.recorder == nil {
+		return
+	}
+
+	if err := s.recorder.WriteResize(time.Now(), width, height); err != nil {
+		s.log.Error("failed to record resize, recording stopped", "error", err)
+		s.recordErr = err
+		s.closeRecorder()
+	}
+}
+
+// stopRecording finishes the recording and the input log once the output is done.
+func (s *Session) stopRecording() {
+	s.recordLock.Lock()
+	defer s.recordLock.Unlock()
+
+	if s.recorder != nil {
+		s.closeRecorder()
+		s.log.Info("recording stopped")
+	}
+
+	if s.inputLog != nil {
+		s.closeInputLog()
+	}
+}
+
+// closeRecorder must be called with recordLock held.
+func (s *Session) closeRecorder() {
+	if err := s.recorder.Close(); err != nil {
+		s.log.Warn("failed to close recording", "error", err)
+	}
+
+	s.recorder = nil
+}
+
+// closeInputLog must be called with recordLock held.
+func (s *Session) closeInputLog() {
+	if err := s.inputLog.Close(); err != nil {
+		s.log.Warn("failed to close input log", "error", err)
+	}
+
+	s.inputLog = nil
+}
@@ -1,10 +1,28 @@
 package session
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"github.com/siriusa51/webtty/audit"
+	"github.com/siriusa51/webtty/recorder"
+	"github.com/siriusa51/webtty/vt"
 	"io"
 	"log/slog"
 	"sync"
+	"syscall"
+	"time"
+)
+
+// size of the screen until the session is resized
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+var (
+	ErrSessionOccupied    = errors.New("session is occupied")
+	ErrSessionForbidden   = errors.New("session belongs to another owner")
+	ErrSignalNotSupported = errors.New("session does not support signals")
 )
 
 type SessionIO interface {
@@ -13,25 +31,109 @@ type SessionIO interface {
 	ResizeWindow(width, height int) error
 }
 
+// Signaler is implemented by a SessionIO that can deliver signals to its foreground process.
+type Signaler interface {
+	Signal(sig syscall.Signal) error
+}
+
+// SecretDetector is implemented by a SessionIO that can tell whether its terminal reads a secret such as a password.
+type SecretDetector interface {
+	ReadingSecret() (bool, error)
+}
+
+// WindowSizer is implemented by a SessionIO that can report the size of its window.
+type WindowSizer interface {
+	GetWindowSize() (int, int, error)
+}
+
+// ExitCoder is implemented by a SessionIO that can report the exit code of its process.
+type ExitCoder interface {
+	ExitCode() (int, bool)
+}
+
 type Message struct {
 	Data  []byte
 	Error error
 }
 
+// Chunk is a piece of session output together with the stream offset of its first byte.
+type Chunk struct {
+	Offset int64
+	Data   []byte
+}
+
 type Session struct {
-	id     string
-	occupy bool
-	sio    SessionIO
-	lock   sync.Mutex
+	id      string
+	profile string
+	occupy  bool
+	sio     SessionIO
+	lock    sync.Mutex
+
+	// owner created the session, participants were invited by the owner to attach as well.
+	owner        string
+	participants map[string]bool
+
+	user    string
+	command string
+	audit   audit.Sink
+
+	newRecorder NewRecorderFunc
+	recorder    recorder.Recorder
+	recordErr   error
+	newInputLog NewInputLogFunc
+	inputLog    *recorder.InputLog
+	recordLock  sync.Mutex
+
+	output     *history
+	screen     *vt.Terminal
+	osc        oscParser
+	title      string
+	cwd        string
+	clipboard  *clipboardFilter
+	clipEvents []ClipboardEvent
+	clipSeq    uint64
+	outputLock sync.Mutex
+	outputWait chan struct{}
+	outputDone bool
+	pumpOnce   sync.Once
+
+	// clipFlush releases what the clipboard filter holds back when no output follows, clipFlushGen is its generation
+	clipFlush    *time.Timer
+	clipFlushGen uint64
 
 	log *slog.Logger
 }
 
-func NewSession(id string, sio SessionIO, log *slog.Logger) *Session {
+func NewSession(id string, sio SessionIO, log *slog.Logger, optfs ...OptionFunc) *Session {
+	return newSession(id, sio, log, newOptions(optfs...))
+}
+
+func newSession(id string, sio SessionIO, log *slog.Logger, opt *options) *Session {
 	sess := &Session{
-		id:  id,
-		sio: sio,
-		log: log.With("sid", id),
+		id:          id,
+		profile:     opt.profile,
+		owner:       opt.owner,
+		user:        opt.user,
+		command:     opt.command,
+		audit:       opt.audit,
+		newRecorder: opt.recorder,
+		newInputLog: opt.inputLog,
+		sio:         sio,
+		output:      newHistory(opt.historySize),
+		outputWait:  make(chan struct{}),
+		log:         log.With("sid", id),
+	}
+
+	width, height := defaultWidth, defaultHeight
+	if sizer, ok := sio.(WindowSizer); ok {
+		if w, h, err := sizer.GetWindowSize(); err == nil && w > 0 && h > 0 {
+			width, height = w, h
+		}
+	}
+	sess.screen = vt.New(width, height)
+
+	if !opt.clipboard.passthrough() {
+		sess.clipboard = newClipboardFilter(opt.clipboard, sess.handleClipboard)
 	}
 
 	return sess
@@ -42,12 +144,68 @@ func (s *Session) GetId() string {
 	return s.id
 }
 
+// GetProfile returns the name of the profile the session was started with.
+func (s *Session) GetProfile() string {
+	return s.profile
+}
+
+// GetCommand returns the command the session runs, if it is known.
+func (s *Session) GetCommand() string {
+	return s.command
+}
+
+// GetUser returns the authenticated user who created the session, if any.
+func (s *Session) GetUser() string {
+	return s.user
+}
+
+// ExitCode returns the exit code of the process once it exited, if the SessionIO can report it.
+func (s *Session) ExitCode() (int, bool) {
+	coder, ok := s.sio.(ExitCoder)
+	if !ok {
+		return 0, false
+	}
+
+	return coder.ExitCode()
+}
+
+// GetOwner returns who created the session, empty if the session has no owner.
+func (s *Session) GetOwner() string {
+	return s.owner
+}
+
+// Invite lets participant attach to the session besides the owner.
+func (s *Session) Invite(participant string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.participants == nil {
+		s.participants = make(map[string]bool)
+	}
+
+	s.log.Info("invite participant", "participant", participant)
+	s.participants[participant] = true
+}
+
+// Allows returns true if caller is the owner or an invited participant.
+// A session without owner allows everybody.
+func (s *Session) Allows(caller string) bool {
+	if s.owner == "" || caller == s.owner {
+		return true
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.participants[caller]
+}
+
 // Close closes the session.
 func (s *Session) Close() error {
 	return s.sio.Close()
 }
 
 // Read reads data from the session.
+// It bypasses the retained output and must not be mixed with ReadOutput.
 func (s *Session) Read(buff []byte) (int, error) {
 	return s.sio.Read(buff)
 }
@@ -59,7 +217,27 @@ func (s *Session) Write(buff []byte) (int, error) {
 
 // ResizeWindow resizes the window of the session.
 func (s *Session) ResizeWindow(width, height int) error {
-	return s.sio.ResizeWindow(width, height)
+	if err := s.sio.ResizeWindow(width, height); err != nil {
+		return err
+	}
+
+	s.outputLock.Lock()
+	s.screen.Resize(width, height)
+	s.outputLock.Unlock()
+
+	s.recordResize(width, height)
+	return nil
+}
+
+// Signal delivers sig to the foreground process of the session.
+func (s *Session) Signal(sig syscall.Signal) error {
+	signaler, ok := s.sio.(Signaler)
+	if !ok {
+		return ErrSignalNotSupported
+	}
+
+	s.log.Info("send signal", "signal", sig)
+	return signaler.Signal(sig)
 }
 
 func (s *Session) Done() <-chan struct{} {
@@ -73,12 +251,16 @@ func (s *Session) Occupied() bool {
 	return s.occupy
 }
 
-// Occupy occupies the session, preventing other users from using it.
-func (s *Session) Occupy() error {
+// Occupy occupies the session for caller, preventing other users from using it.
+func (s *Session) Occupy(caller string) error {
+	if !s.Allows(caller) {
+		return ErrSessionForbidden
+	}
+
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	if s.occupy {
-		return fmt.Errorf("session is occupied")
+		return ErrSessionOccupied
 	}
 
 	s.log.Info("occupy session")
@@ -97,3 +279,254 @@ func (s *Session) Release() {
 	s.log.Info("release session")
 	s.occupy = false
 }
+
+// start begins copying the session output into the retained history.
+// It is safe to call more than once.
+func (s *Session) start() {
+	s.pumpOnce.Do(func() {
+		s.startRecording()
+		go s.pump()
+		go s.auditExit()
+	})
+}
+
+// auditExit reports to the audit sink when the session process is done.
+func (s *Session) auditExit() {
+	<-s.sio.Done()
+
+	event := audit.Event{
+		Time:    time.Now(),
+		Type:    audit.EventExit,
+		Sid:     s.id,
+		User:    s.user,
+		Profile: s.profile,
+		Command: s.command,
+	}
+
+	if code, ok := s.ExitCode(); ok {
+		event.ExitStatus = &code
+	}
+
+	if err := s.audit.Write(event); err != nil {
+		s.log.Warn("failed to write audit event", "error", err)
+	}
+}
+
+func (s *Session) pump() {
+	buff := make([]byte, 4096)
+
+	for {
+		n, err := s.sio.Read(buff)
+		if n > 0 {
+			s.outputLock.Lock()
+			data := buff[:n]
+			if s.clipboard != nil {
+				data = s.clipboard.Filter(data)
+				s.scheduleClipboardFlush()
+			}
+
+			s.writeOutput(data)
+			s.outputLock.Unlock()
+		}
+
+		if err != nil {
+			s.log.Info("session output finished", "reason", err)
+
+			if s.clipboard != nil {
+				// nothing follows what the clipboard filter holds back
+				s.outputLock.Lock()
+				s.clipFlushGen++
+				s.writeOutput(s.clipboard.Flush())
+				s.outputLock.Unlock()
+			}
+
+			s.stopRecording()
+
+			s.outputLock.Lock()
+			s.outputDone = true
+			s.broadcast()
+			s.outputLock.Unlock()
+			return
+		}
+	}
+}
+
+// writeOutput passes output on to the history, the screen and the recording and wakes up the readers,
+// who may wait for clipboard writes filtered out of it as well. Must be called with outputLock held.
+func (s *Session) writeOutput(data []byte) {
+	s.osc.Feed(data, s.handleOSC)
+	s.output.Write(data)
+	s.screen.Write(data)
+	s.recordOutput(data)
+	s.broadcast()
+}
+
+// scheduleClipboardFlush releases what the clipboard filter holds back at the end of the output unless more output
+// follows soon, must be called with outputLock held.
+func (s *Session) scheduleClipboardFlush() {
+	s.clipFlushGen++
+	if s.clipFlush != nil {
+		s.clipFlush.Stop()
+	}
+
+	if !s.clipboard.Pending() {
+		return
+	}
+
+	gen := s.clipFlushGen
+	s.clipFlush = time.AfterFunc(clipboardFlushDelay, func() {
+		s.outputLock.Lock()
+		defer s.outputLock.Unlock()
+
+		// more output came in meanwhile and decided about the held back bytes
+		if gen == s.clipFlushGen {
+			s.writeOutput(s.clipboard.Flush())
+		}
+	})
+}
+
+// handleOSC keeps track of the window title and working directory, must be called with outputLock held.
+func (s *Session) handleOSC(cmd string, payload []byte) {
+	switch cmd {
+	case "0", "2":
+		s.title = sanitizeOSCText(payload)
+	case "7":
+		if cwd, ok := parseOSC7(payload); ok {
+			s.cwd = sanitizeOSCText([]byte(cwd))
+		}
+	}
+}
+
+// handleClipboard keeps a forwarded clipboard write for readers, must be called with outputLock held.
+func (s *Session) handleClipboard(event ClipboardEvent) {
+	s.clipSeq++
+	event.Seq = s.clipSeq
+	s.clipEvents = append(s.clipEvents, event)
+
+	if len(s.clipEvents) > maxClipboardEvents {
+		s.clipEvents = s.clipEvents[len(s.clipEvents)-maxClipboardEvents:]
+	}
+}
+
+// ClipboardSeq returns the sequence number of the latest forwarded clipboard write.
+func (s *Session) ClipboardSeq() uint64 {
+	s.outputLock.Lock()
+	defer s.outputLock.Unlock()
+	return s.clipSeq
+}
+
+// ReadClipboard blocks until clipboard writes newer than seq are forwarded and returns them.
+// It returns io.EOF once the session has finished.
+func (s *Session) ReadClipboard(ctx context.Context, seq uint64) ([]ClipboardEvent, error) {
+	s.start()
+
+	for {
+		s.outputLock.Lock()
+		var events []ClipboardEvent
+		for _, event := range s.clipEvents {
+			if event.Seq > seq {
+				events = append(events, event)
+			}
+		}
+		done, wait := s.outputDone, s.outputWait
+		s.outputLock.Unlock()
+
+		if len(events) > 0 {
+			return events, nil
+		}
+
+		if done {
+			return nil, io.EOF
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-wait:
+		}
+	}
+}
+
+// GetTitle returns the last window title set by the session process.
+func (s *Session) GetTitle() string {
+	s.outputLock.Lock()
+	defer s.outputLock.Unlock()
+	return s.title
+}
+
+// GetCwd returns the last working directory reported by the session process.
+func (s *Session) GetCwd() string {
+	s.outputLock.Lock()
+	defer s.outputLock.Unlock()
+	return s.cwd
+}
+
+// broadcast wakes up every reader waiting for output, must be called with outputLock held.
+func (s *Session) broadcast() {
+	close(s.outputWait)
+	s.outputWait = make(chan struct{})
+}
+
+// OutputRange returns the offsets of the oldest retained byte and just past the newest byte.
+func (s *Session) OutputRange() (int64, int64) {
+	s.outputLock.Lock()
+	defer s.outputLock.Unlock()
+	return s.output.Start(), s.output.End()
+}
+
+// Output returns a copy of all retained output without waiting for more.
+func (s *Session) Output() Chunk {
+	s.outputLock.Lock()
+	defer s.outputLock.Unlock()
+
+	data, from := s.output.ReadAt(s.output.Start(), 0)
+	return Chunk{Offset: from, Data: data}
+}
+
+// Repaint returns terminal output that reproduces the current screen of the session on a terminal of the
+// same size, together with the offset of the output it reflects, so readers can continue from there.
+func (s *Session) Repaint() Chunk {
+	s.start()
+
+	s.outputLock.Lock()
+	defer s.outputLock.Unlock()
+	return Chunk{Offset: s.output.End(), Data: s.screen.Repaint()}
+}
+
+// Screen returns what the terminal of the session currently shows.
+func (s *Session) Screen() vt.Snapshot {
+	s.start()
+
+	s.outputLock.Lock()
+	defer s.outputLock.Unlock()
+	return s.screen.Snapshot()
+}
+
+// ReadOutput blocks until output at offset is available and returns at most max bytes of it.
+// If offset is no longer retained, the chunk starts at the oldest retained byte instead,
+// so callers detect lost output by comparing Chunk.Offset with the requested offset.
+// It returns io.EOF once the session has finished and all output has been read.
+func (s *Session) ReadOutput(ctx context.Context, offset int64, max int) (Chunk, error) {
+	s.start()
+
+	for {
+		s.outputLock.Lock()
+		data, from := s.output.ReadAt(offset, max)
+		done, wait := s.outputDone, s.outputWait
+		s.outputLock.Unlock()
+
+		if len(data) > 0 || from != offset {
+			return Chunk{Offset: from, Data: data}, nil
+		}
+
+		if done {
+			return Chunk{Offset: from}, io.EOF
+		}
+
+		select {
+		case <-ctx.Done():
+			return Chunk{Offset: from}, ctx.Err()
+		case <-wait:
+		}
+	}
+}
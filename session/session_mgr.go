@@ -1,11 +1,20 @@
 package session
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
 	"sync"
 )
 
+var (
+	ErrSessionLimit    = errors.New("session limit reached")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
 type NewSessionIOFunc func() (SessionIO, error)
 
 type SessionManager struct {
@@ -24,28 +33,112 @@ func NewSessionManager(optfs ...OptionFunc) *SessionManager {
 	}
 }
 
-// GetSession returns a session by id. If the session does not exist, it will create a new session
-func (mgr *SessionManager) GetSession(id string, f NewSessionIOFunc) (*Session, error) {
+// GetSession returns a session by id. If the session does not exist, it will create a new session owned by caller,
+// optfs are only applied to the newly created session. An existing session is only returned to its owner
+// and invited participants.
+func (mgr *SessionManager) GetSession(id string, caller string, f NewSessionIOFunc, optfs ...OptionFunc) (*Session, error) {
 	mgr.lock.Lock()
 	defer mgr.lock.Unlock()
 
 	if session, exist := mgr.sessions[id]; exist {
+		if !session.Allows(caller) {
+			mgr.log.With("sid", id).Warn("session belongs to another owner")
+			return nil, ErrSessionForbidden
+		}
+
 		mgr.log.With("sid", id).Info("session already exist")
 		return session, nil
 	}
 
+	return mgr.createSession(id, caller, f, optfs...)
+}
+
+// CreateSession creates a session with a random id owned by caller.
+func (mgr *SessionManager) CreateSession(caller string, f NewSessionIOFunc, optfs ...OptionFunc) (*Session, error) {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+
+	for {
+		id, err := newSessionId()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, exist := mgr.sessions[id]; !exist {
+			return mgr.createSession(id, caller, f, optfs...)
+		}
+	}
+}
+
+// AttachSession returns an existing session to its owner and invited participants.
+func (mgr *SessionManager) AttachSession(id string, caller string) (*Session, error) {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+
+	session, exist := mgr.sessions[id]
+	if !exist {
+		return nil, ErrSessionNotFound
+	}
+
+	if !session.Allows(caller) {
+		mgr.log.With("sid", id).Warn("session belongs to another owner")
+		return nil, ErrSessionForbidden
+	}
+
+	return session, nil
+}
+
+// createSession creates a session, the caller must hold the lock.
+func (mgr *SessionManager) createSession(id string, caller string, f NewSessionIOFunc, optfs ...OptionFunc) (*Session, error) {
+	if mgr.opt.maxSessions > 0 && len(mgr.sessions) >= mgr.opt.maxSessions {
+		return nil, ErrSessionLimit
+	}
+
 	sio, err := f()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create session io: %w", err)
 	}
 
-	session := NewSession(id, sio, mgr.log)
+	opt := *mgr.opt
+	for _, optf := range optfs {
+		optf(&opt)
+	}
+	opt.owner = caller
+
+	session := newSession(id, sio, mgr.log, &opt)
+	session.start()
 
 	mgr.sessions[id] = session
 	mgr.log.With("sid", id).Info("session created")
 	return session, nil
 }
 
+// FindSession returns an existing session by id.
+func (mgr *SessionManager) FindSession(id string) (*Session, bool) {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+
+	session, exist := mgr.sessions[id]
+	return session, exist
+}
+
+// ListSessions returns all sessions ordered by id.
+func (mgr *SessionManager) ListSessions() []*Session {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+
+	sessions := make([]*Session, 0, len(mgr.sessions))
+	for _, session := range mgr.sessions {
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].GetId() < sessions[j].GetId()
+	})
+
+	return sessions
+}
+
 // HasSession checks if a session exists by id
 func (mgr *SessionManager) HasSession(id string) bool {
 	mgr.lock.Lock()
@@ -55,16 +148,34 @@ func (mgr *SessionManager) HasSession(id string) bool {
 	return exist
 }
 
-// RemoveSession removes a session by id
-func (mgr *SessionManager) RemoveSession(id string) {
+// RemoveSession removes a session by id, only the owner and invited participants may remove it.
+func (mgr *SessionManager) RemoveSession(id string, caller string) error {
 	mgr.lock.Lock()
 	defer mgr.lock.Unlock()
 
-	if session, exist := mgr.sessions[id]; exist {
-		session.Close()
-		delete(mgr.sessions, id)
-		mgr.log.With("sid", id).Info("session removed")
-	} else {
+	session, exist := mgr.sessions[id]
+	if !exist {
 		mgr.log.With("sid", id).Warn("session not found")
+		return ErrSessionNotFound
+	}
+
+	if !session.Allows(caller) {
+		mgr.log.With("sid", id).Warn("session belongs to another owner")
+		return ErrSessionForbidden
 	}
+
+	session.Close()
+	delete(mgr.sessions, id)
+	mgr.log.With("sid", id).Info("session removed")
+	return nil
+}
+
+// newSessionId returns a random session id that can not be guessed.
+func newSessionId() (string, error) {
+	buff := make([]byte, 16)
+	if _, err := rand.Read(buff); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buff), nil
 }
@@ -11,20 +11,112 @@ func TestSessionManager(t *testing.T) {
 			return newMockSessionIO(), nil
 		}
 		mgr := NewSessionManager()
-		sess1, err := mgr.GetSession("sess1", f)
+		sess1, err := mgr.GetSession("sess1", "alice", f)
 		assert.NoError(t, err)
 		assert.Equal(t, "sess1", sess1.GetId())
 
 		exist := mgr.HasSession("sess1")
 		assert.True(t, exist)
 
-		temp, err := mgr.GetSession("sess1", f)
+		temp, err := mgr.GetSession("sess1", "alice", f)
 		assert.NoError(t, err)
 		assert.Equal(t, sess1, temp)
 
-		mgr.RemoveSession("sess1")
+		assert.Equal(t, []*Session{sess1}, mgr.ListSessions())
+
+		found, exist := mgr.FindSession("sess1")
+		assert.True(t, exist)
+		assert.Equal(t, sess1, found)
+
+		assert.NoError(t, mgr.RemoveSession("sess1", "alice"))
 		exist = mgr.HasSession("sess1")
 		assert.False(t, exist)
+
+		assert.ErrorIs(t, mgr.RemoveSession("sess1", "alice"), ErrSessionNotFound)
+	})
+
+	t.Run("test session owner", func(t *testing.T) {
+		f := func() (SessionIO, error) {
+			return newMockSessionIO(), nil
+		}
+
+		mgr := NewSessionManager()
+		sess1, err := mgr.GetSession("sess1", "alice", f)
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", sess1.GetOwner())
+
+		_, err = mgr.GetSession("sess1", "bob", f)
+		assert.ErrorIs(t, err, ErrSessionForbidden)
+		assert.ErrorIs(t, mgr.RemoveSession("sess1", "bob"), ErrSessionForbidden)
+
+		sess1.Invite("bob")
+		temp, err := mgr.GetSession("sess1", "bob", f)
+		assert.NoError(t, err)
+		assert.Equal(t, sess1, temp)
+
+		assert.NoError(t, mgr.RemoveSession("sess1", "bob"))
+	})
+
+	t.Run("test session options", func(t *testing.T) {
+		f := func() (SessionIO, error) {
+			return newMockSessionIO(), nil
+		}
+
+		mgr := NewSessionManager()
+		sess1, err := mgr.GetSession("sess1", "alice", f, WithProfile("admin"))
+		assert.NoError(t, err)
+		assert.Equal(t, "admin", sess1.GetProfile())
+
+		temp, err := mgr.GetSession("sess1", "alice", f, WithProfile("other"))
+		assert.NoError(t, err)
+		assert.Equal(t, "admin", temp.GetProfile())
+	})
+
+	t.Run("test CreateSession()", func(t *testing.T) {
+		f := func() (SessionIO, error) {
+			return newMockSessionIO(), nil
+		}
+
+		mgr := NewSessionManager()
+		sess1, err := mgr.CreateSession("alice", f, WithProfile("admin"))
+		assert.NoError(t, err)
+		assert.Len(t, sess1.GetId(), 22)
+		assert.Equal(t, "alice", sess1.GetOwner())
+		assert.Equal(t, "admin", sess1.GetProfile())
+
+		sess2, err := mgr.CreateSession("alice", f)
+		assert.NoError(t, err)
+		assert.NotEqual(t, sess1.GetId(), sess2.GetId())
+
+		temp, err := mgr.AttachSession(sess1.GetId(), "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, sess1, temp)
+
+		_, err = mgr.AttachSession(sess1.GetId(), "bob")
+		assert.ErrorIs(t, err, ErrSessionForbidden)
+
+		_, err = mgr.AttachSession("unknown", "alice")
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+	})
+
+	t.Run("test session limit", func(t *testing.T) {
+		f := func() (SessionIO, error) {
+			return newMockSessionIO(), nil
+		}
+
+		mgr := NewSessionManager(WithMaxSessions(1))
+		_, err := mgr.GetSession("sess1", "alice", f)
+		assert.NoError(t, err)
+
+		_, err = mgr.GetSession("sess1", "alice", f)
+		assert.NoError(t, err)
+
+		_, err = mgr.GetSession("sess2", "alice", f)
+		assert.ErrorIs(t, err, ErrSessionLimit)
+
+		assert.NoError(t, mgr.RemoveSession("sess1", "alice"))
+		_, err = mgr.GetSession("sess2", "alice", f)
+		assert.NoError(t, err)
 	})
 
 	t.Run("test new session error", func(t *testing.T) {
@@ -33,7 +125,7 @@ func TestSessionManager(t *testing.T) {
 		}
 
 		mgr := NewSessionManager()
-		_, err := mgr.GetSession("sess1", f)
+		_, err := mgr.GetSession("sess1", "alice", f)
 		assert.Error(t, err)
 
 		exist := mgr.HasSession("sess1")
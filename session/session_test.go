@@ -3,10 +3,19 @@ package session
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"github.com/siriusa51/webtty/audit"
+	"github.com/siriusa51/webtty/recorder"
+	"github.com/siriusa51/webtty/vt"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 )
 
 type mockSessionIO struct {
@@ -51,6 +60,27 @@ func (m *mockSessionIO) ResizeWindow(width, height int) error {
 	return nil
 }
 
+// pipeSessionIO is a SessionIO whose output is fed through a pipe, so reads block until data is written.
+type pipeSessionIO struct {
+	*mockSessionIO
+	reader *io.PipeReader
+	writer *io.PipeWriter
+}
+
+func newPipeSessionIO() *pipeSessionIO {
+	reader, writer := io.Pipe()
+	return &pipeSessionIO{mockSessionIO: newMockSessionIO(), reader: reader, writer: writer}
+}
+
+func (p *pipeSessionIO) Read(buff []byte) (int, error) {
+	return p.reader.Read(buff)
+}
+
+func (p *pipeSessionIO) Close() error {
+	p.writer.Close()
+	return p.mockSessionIO.Close()
+}
+
 func newMockSession(id string, sio SessionIO) *Session {
 	return NewSession(id, sio, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})))
 }
@@ -84,13 +114,31 @@ func TestSession_Occupied(t *testing.T) {
 		sess := newMockSession("test", newMockSessionIO())
 		assert.False(t, sess.Occupied())
 
-		err := sess.Occupy()
+		err := sess.Occupy("")
 		assert.NoError(t, err)
 		assert.True(t, sess.Occupied())
 
-		err = sess.Occupy()
-		assert.Error(t, err)
+		err = sess.Occupy("")
+		assert.ErrorIs(t, err, ErrSessionOccupied)
+
+	})
+
+	t.Run("test Occupy() by owner", func(t *testing.T) {
+		mgr := NewSessionManager()
+		sess, err := mgr.CreateSession("alice", func() (SessionIO, error) {
+			return newMockSessionIO(), nil
+		})
+		assert.NoError(t, err)
+		defer mgr.RemoveSession(sess.GetId(), "alice")
+
+		assert.ErrorIs(t, sess.Occupy("bob"), ErrSessionForbidden)
+		assert.False(t, sess.Occupied())
 
+		sess.Invite("bob")
+		assert.NoError(t, sess.Occupy("bob"))
+		sess.Release()
+
+		assert.NoError(t, sess.Occupy("alice"))
 	})
 }
 
@@ -102,7 +150,7 @@ func TestSession_Release(t *testing.T) {
 		sess.Release()
 		assert.False(t, sess.Occupied())
 
-		err := sess.Occupy()
+		err := sess.Occupy("")
 		assert.NoError(t, err)
 
 		sess.Release()
@@ -145,3 +193,343 @@ func TestSession_ReadWrite(t *testing.T) {
 		assert.Equal(t, "llo world", string(buff[:n]))
 	})
 }
+
+func TestSession_ReadOutput(t *testing.T) {
+	t.Run("test ReadOutput()", func(t *testing.T) {
+		sio := newPipeSessionIO()
+		sess := newMockSession("test", sio)
+		ctx := context.Background()
+
+		go sio.writer.Write([]byte("hello world"))
+
+		chunk, err := sess.ReadOutput(ctx, 0, 5)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), chunk.Offset)
+		assert.Equal(t, "hello", string(chunk.Data))
+
+		chunk, err = sess.ReadOutput(ctx, 5, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), chunk.Offset)
+		assert.Equal(t, " world", string(chunk.Data))
+
+		start, end := sess.OutputRange()
+		assert.Equal(t, int64(0), start)
+		assert.Equal(t, int64(11), end)
+		assert.Equal(t, Chunk{Offset: 0, Data: []byte("hello world")}, sess.Output())
+
+		assert.NoError(t, sess.Close())
+		_, err = sess.ReadOutput(ctx, 11, 0)
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("test ReadOutput() gap", func(t *testing.T) {
+		sio := newPipeSessionIO()
+		sess := NewSession("test", sio, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})), WithHistorySize(4))
+		defer sess.Close()
+
+		sess.start()
+		go sio.writer.Write([]byte("hello world"))
+
+		assert.Eventually(t, func() bool {
+			_, end := sess.OutputRange()
+			return end == 11
+		}, time.Second, 10*time.Millisecond)
+
+		chunk, err := sess.ReadOutput(context.Background(), 2, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), chunk.Offset)
+		assert.Equal(t, "orld", string(chunk.Data))
+	})
+
+	t.Run("test ReadOutput() cancel", func(t *testing.T) {
+		sess := newMockSession("test", newPipeSessionIO())
+		defer sess.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := sess.ReadOutput(ctx, 0, 0)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestSession_Repaint(t *testing.T) {
+	t.Run("test Repaint()", func(t *testing.T) {
+		sio := newPipeSessionIO()
+		sess := newMockSession("test", sio)
+		defer sess.Close()
+
+		assert.NoError(t, sess.ResizeWindow(20, 5))
+		sess.start()
+		go sio.writer.Write([]byte("$ top\r\n\x1b[?1049h\x1b[Hload"))
+
+		assert.Eventually(t, func() bool {
+			_, end := sess.OutputRange()
+			return end == 22
+		}, time.Second, 10*time.Millisecond)
+
+		chunk := sess.Repaint()
+		assert.Equal(t, int64(22), chunk.Offset)
+
+		screen := vt.New(20, 5)
+		screen.Write(chunk.Data)
+		assert.True(t, screen.AltScreen())
+		assert.Equal(t, 'l', screen.Lines()[0][0].Rune)
+
+		snapshot := sess.Screen()
+		assert.True(t, snapshot.AltScreen)
+		assert.Equal(t, "load", vt.LineText(snapshot.Lines[0]))
+	})
+}
+
+func TestSession_Signal(t *testing.T) {
+	t.Run("test Signal() not supported", func(t *testing.T) {
+		sess := newMockSession("test", newMockSessionIO())
+		assert.ErrorIs(t, sess.Signal(syscall.SIGINT), ErrSignalNotSupported)
+	})
+}
+
+func TestSession_TitleCwd(t *testing.T) {
+	t.Run("test GetTitle()/GetCwd()", func(t *testing.T) {
+		sio := newPipeSessionIO()
+		sess := newMockSession("test", sio)
+		defer sess.Close()
+
+		go sio.writer.Write([]byte("\x1b]0;vim main.go\x07\x1b]7;file://host/src/app\x07$ "))
+
+		chunk, err := sess.ReadOutput(context.Background(), 0, 0)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, chunk.Data)
+		assert.Equal(t, "vim main.go", sess.GetTitle())
+		assert.Equal(t, "/src/app", sess.GetCwd())
+	})
+}
+
+func TestSession_ReadClipboard(t *testing.T) {
+	t.Run("test ReadClipboard()", func(t *testing.T) {
+		sio := newPipeSessionIO()
+		sess := NewSession("test", sio, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})),
+			WithClipboardPolicy(ClipboardPolicy{Forward: true}))
+		ctx := context.Background()
+
+		seq := sess.ClipboardSeq()
+		go sio.writer.Write([]byte("\x1b]52;c;aGVsbG8=\x07"))
+
+		events, err := sess.ReadClipboard(ctx, seq)
+		assert.NoError(t, err)
+		assert.Equal(t, []ClipboardEvent{{Seq: 1, Selection: "c", Data: "aGVsbG8="}}, events)
+
+		assert.NoError(t, sess.Close())
+		_, err = sess.ReadClipboard(ctx, 1)
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("test trailing escape is not held back", func(t *testing.T) {
+		sio := newPipeSessionIO()
+		sess := NewSession("test", sio, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})),
+			WithClipboardPolicy(ClipboardPolicy{Mode: ClipboardDeny}))
+		defer sess.Close()
+
+		sess.start()
+		go sio.writer.Write([]byte("$ \x1b"))
+
+		assert.Eventually(t, func() bool {
+			return string(sess.Output().Data) == "$ \x1b"
+		}, time.Second, 10*time.Millisecond)
+
+		go sio.writer.Write([]byte("]52;c;aGVsbG8=\x07x"))
+
+		chunk, err := sess.ReadOutput(context.Background(), 3, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "]52;c;aGVsbG8=\x07x", string(chunk.Data))
+	})
+
+	t.Run("test unterminated clipboard sequence is dropped", func(t *testing.T) {
+		sio := newPipeSessionIO()
+		sess := NewSession("test", sio, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})),
+			WithClipboardPolicy(ClipboardPolicy{Mode: ClipboardDeny}))
+		defer sess.Close()
+
+		sess.start()
+		go sio.writer.Write([]byte("\x1b]52;c;"))
+
+		assert.Eventually(t, func() bool {
+			sess.outputLock.Lock()
+			defer sess.outputLock.Unlock()
+			return sess.clipFlushGen > 0 && !sess.clipboard.Pending()
+		}, time.Second, 10*time.Millisecond)
+
+		go sio.writer.Write([]byte("normal text\r\n"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		chunk, err := sess.ReadOutput(ctx, 0, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "normal text\r\n", string(chunk.Data))
+	})
+}
+
+// exitSessionIO is a SessionIO that reports an exit code once it is closed.
+type exitSessionIO struct {
+	*mockSessionIO
+	code int
+}
+
+func (e *exitSessionIO) ExitCode() (int, bool) {
+	select {
+	case <-e.Done():
+		return e.code, true
+	default:
+		return 0, false
+	}
+}
+
+// recordSink keeps the audit events written to it.
+type recordSink struct {
+	events chan audit.Event
+}
+
+func (r *recordSink) Write(event audit.Event) error {
+	r.events <- event
+	return nil
+}
+
+func (r *recordSink) Close() error {
+	return nil
+}
+
+func TestSession_AuditExit(t *testing.T) {
+	t.Run("test exit event", func(t *testing.T) {
+		sink := &recordSink{events: make(chan audit.Event, 1)}
+		sio := &exitSessionIO{mockSessionIO: newMockSessionIO(), code: 2}
+		sess := NewSession("test", sio, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})),
+			WithAuditSink(sink), WithUser("alice"), WithCommand("bash"), WithProfile("default"))
+		sess.start()
+
+		assert.NoError(t, sess.Close())
+
+		select {
+		case event := <-sink.events:
+			assert.Equal(t, audit.EventExit, event.Type)
+			assert.Equal(t, "test", event.Sid)
+			assert.Equal(t, "alice", event.User)
+			assert.Equal(t, "bash", event.Command)
+			assert.Equal(t, 2, *event.ExitStatus)
+		case <-time.After(time.Second):
+			t.Fatal("exit event is not written")
+		}
+	})
+}
+
+// memoryRecorder keeps what is recorded.
+type memoryRecorder struct {
+	lock   sync.Mutex
+	output bytes.Buffer
+	sizes  []string
+	closed chan struct{}
+}
+
+func (m *memoryRecorder) WriteOutput(at time.Time, data []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.output.Write(data)
+	return nil
+}
+
+func (m *memoryRecorder) WriteResize(at time.Time, width, height int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.sizes = append(m.sizes, fmt.Sprintf("%dx%d", width, height))
+	return nil
+}
+
+func (m *memoryRecorder) Close() error {
+	close(m.closed)
+	return nil
+}
+
+func TestSession_Record(t *testing.T) {
+	t.Run("test recording", func(t *testing.T) {
+		rec := &memoryRecorder{closed: make(chan struct{})}
+		sio := newPipeSessionIO()
+		sess := NewSession("test", sio, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})),
+			WithRecorder(func(id string, start time.Time) (recorder.Recorder, error) {
+				assert.Equal(t, "test", id)
+				return rec, nil
+			}))
+		sess.start()
+
+		assert.NoError(t, sess.ResizeWindow(100, 30))
+		sio.writer.Write([]byte("hello"))
+		assert.NoError(t, sess.Close())
+
+		select {
+		case <-rec.closed:
+		case <-time.After(time.Second):
+			t.Fatal("recording is not closed")
+		}
+
+		assert.Equal(t, "hello", rec.output.String())
+		assert.Equal(t, []string{"100x30"}, rec.sizes)
+	})
+
+	t.Run("test recording error", func(t *testing.T) {
+		sess := NewSession("test", newPipeSessionIO(), slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})),
+			WithRecorder(func(id string, start time.Time) (recorder.Recorder, error) {
+				return nil, recorder.ErrDiskFull
+			}))
+		assert.NoError(t, sess.RecordingError())
+
+		sess.start()
+		assert.ErrorIs(t, sess.RecordingError(), recorder.ErrDiskFull)
+		assert.NoError(t, sess.Close())
+	})
+}
+
+// secretSessionIO is a SessionIO whose terminal can be switched to reading a secret.
+type secretSessionIO struct {
+	*pipeSessionIO
+	secret bool
+}
+
+func (s *secretSessionIO) ReadingSecret() (bool, error) {
+	return s.secret, nil
+}
+
+// bufferCloser is a bytes.Buffer that can be closed.
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferCloser) Close() error {
+	return nil
+}
+
+func TestSession_LogInput(t *testing.T) {
+	t.Run("test LogInput()", func(t *testing.T) {
+		buff := &bufferCloser{}
+		sio := &secretSessionIO{pipeSessionIO: newPipeSessionIO()}
+		sess := NewSession("test", sio, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})),
+			WithInputLog(func(id string, start time.Time) (*recorder.InputLog, error) {
+				return recorder.NewInputLog(buff), nil
+			}))
+		sess.start()
+
+		sess.LogInput("alice", []byte("ls\r"))
+		sio.secret = true
+		sess.LogInput("alice", []byte("secret\r"))
+		assert.NoError(t, sess.Close())
+
+		lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+		assert.Len(t, lines, 2)
+		assert.Contains(t, lines[0], `"user":"alice","data":"ls\r"`)
+		assert.Contains(t, lines[1], `"user":"alice","redacted":true`)
+		assert.NotContains(t, buff.String(), "secret")
+	})
+
+	t.Run("test LogInput() without input log", func(t *testing.T) {
+		sess := newMockSession("test", newMockSessionIO())
+		sess.LogInput("alice", []byte("ls\r"))
+	})
+}
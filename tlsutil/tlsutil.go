@@ -0,0 +1,145 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultCheckInterval is how often the certificate files are checked for changes.
+const defaultCheckInterval = 10 * time.Second
+
+// CertReloader serves a certificate from files and reloads it when the files change,
+// so renewed certificates are picked up without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	log      *slog.Logger
+
+	lock          sync.Mutex
+	cert          *tls.Certificate
+	modTime       time.Time
+	lastCheck     time.Time
+	checkInterval time.Duration
+}
+
+func NewCertReloader(certFile, keyFile string, log *slog.Logger) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		log:           log.With("module", "tlsutil", "cert", certFile),
+		checkInterval: defaultCheckInterval,
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// filesModTime returns the latest modification time of the certificate and key files.
+func (r *CertReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+func (r *CertReloader) load() error {
+	modTime, err := r.filesModTime()
+	if err != nil {
+		return fmt.Errorf("failed to stat certificate: %w", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// GetCertificate returns the current certificate, it is meant for tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if time.Since(r.lastCheck) < r.checkInterval {
+		return r.cert, nil
+	}
+
+	r.lastCheck = time.Now()
+	modTime, err := r.filesModTime()
+	if err != nil {
+		r.log.Warn("failed to check certificate", "error", err)
+		return r.cert, nil
+	}
+
+	if !modTime.Equal(r.modTime) {
+		// keep serving the old certificate if the new one can not be loaded, e.g. it is only half written
+		if err := r.load(); err != nil {
+			r.log.Error("failed to reload certificate", "error", err)
+		} else {
+			r.log.Info("certificate reloaded")
+		}
+	}
+
+	return r.cert, nil
+}
+
+// LoadCertPool loads the PEM encoded certificates of a CA bundle.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	content, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ca bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no certificate found in ca bundle %s", caFile)
+	}
+
+	return pool, nil
+}
+
+// NewServerConfig returns a TLS config serving the certificate of the files.
+// If clientCAFile is set, clients must present a certificate signed by one of its CAs.
+func NewServerConfig(certFile, keyFile, clientCAFile string, log *slog.Logger) (*tls.Config, error) {
+	reloader, err := NewCertReloader(certFile, keyFile, log)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if clientCAFile != "" {
+		pool, err := LoadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
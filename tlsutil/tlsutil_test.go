@@ -0,0 +1,118 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for the common name to the files.
+func writeCert(t *testing.T, certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
+
+	t.Run("test reload on change", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		writeCert(t, certFile, keyFile, "first")
+
+		reloader, err := NewCertReloader(certFile, keyFile, log)
+		assert.NoError(t, err)
+		reloader.checkInterval = 0
+
+		cert, err := reloader.GetCertificate(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "first", commonName(t, cert))
+
+		writeCert(t, certFile, keyFile, "second")
+		later := time.Now().Add(time.Minute)
+		assert.NoError(t, os.Chtimes(certFile, later, later))
+
+		cert, err = reloader.GetCertificate(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "second", commonName(t, cert))
+	})
+
+	t.Run("test keep certificate on broken file", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		writeCert(t, certFile, keyFile, "first")
+
+		reloader, err := NewCertReloader(certFile, keyFile, log)
+		assert.NoError(t, err)
+		reloader.checkInterval = 0
+
+		assert.NoError(t, os.WriteFile(certFile, []byte("broken"), 0600))
+		later := time.Now().Add(time.Minute)
+		assert.NoError(t, os.Chtimes(certFile, later, later))
+
+		cert, err := reloader.GetCertificate(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "first", commonName(t, cert))
+	})
+
+	t.Run("test missing files", func(t *testing.T) {
+		_, err := NewCertReloader("/not/exist.pem", "/not/exist.key", log)
+		assert.Error(t, err)
+	})
+}
+
+func TestNewServerConfig(t *testing.T) {
+	t.Run("test client ca", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		writeCert(t, certFile, keyFile, "server")
+
+		log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
+		config, err := NewServerConfig(certFile, keyFile, "", log)
+		assert.NoError(t, err)
+		assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+
+		config, err = NewServerConfig(certFile, keyFile, certFile, log)
+		assert.NoError(t, err)
+		assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+		assert.NotNil(t, config.ClientCAs)
+
+		_, err = NewServerConfig(certFile, keyFile, keyFile, log)
+		assert.Error(t, err)
+	})
+}
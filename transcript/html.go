@@ -0,0 +1,93 @@
+package transcript
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/siriusa51/webtty/vt"
+	"html"
+	"io"
+	"strings"
+)
+
+// css returns the inline style of text written in s, empty for the default style.
+func css(s vt.Style) string {
+	fg, bg := s.Colors()
+
+	var rules []string
+	if fg != "" {
+		rules = append(rules, "color:"+fg)
+	}
+	if bg != "" {
+		rules = append(rules, "background-color:"+bg)
+	}
+	if s.Attrs&vt.Bold != 0 {
+		rules = append(rules, "font-weight:bold")
+	}
+	if s.Attrs&vt.Faint != 0 {
+		rules = append(rules, "opacity:0.7")
+	}
+	if s.Attrs&vt.Italic != 0 {
+		rules = append(rules, "font-style:italic")
+	}
+
+	var decorations []string
+	if s.Attrs&vt.Underline != 0 {
+		decorations = append(decorations, "underline")
+	}
+	if s.Attrs&vt.Strike != 0 {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		rules = append(rules, "text-decoration:"+strings.Join(decorations, " "))
+	}
+
+	return strings.Join(rules, ";")
+}
+
+// HTML writes terminal output as a standalone HTML document titled title, keeping its colors and attributes.
+func HTML(w io.Writer, title string, data []byte) error {
+	buff := bufio.NewWriter(w)
+
+	fmt.Fprintf(buff, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { margin: 0; background: %s; }
+pre { margin: 0; padding: 1em; color: %s; font-family: Consolas, "Liberation Mono", Menlo, Courier, monospace; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<pre>`, html.EscapeString(title), vt.DefaultBackground, vt.DefaultForeground)
+
+	err := render(data, func(_ int, line []cell) error {
+		writeLine(buff, line)
+		return buff.WriteByte('\n')
+	})
+	if err != nil {
+		return err
+	}
+
+	buff.WriteString("</pre>\n</body>\n</html>\n")
+	return buff.Flush()
+}
+
+// writeLine writes the cells of a line, runs of cells in the same style share a span.
+func writeLine(w *bufio.Writer, line []cell) {
+	for i := 0; i < len(line); {
+		j := i
+		var text strings.Builder
+		for ; j < len(line) && line[j].style == line[i].style; j++ {
+			text.WriteRune(line[j].r)
+		}
+
+		if css := css(line[i].style); css != "" {
+			fmt.Fprintf(w, `<span style="%s">%s</span>`, css, html.EscapeString(text.String()))
+		} else {
+			w.WriteString(html.EscapeString(text.String()))
+		}
+
+		i = j
+	}
+}
@@ -0,0 +1,51 @@
+package transcript
+
+import "regexp"
+
+// Match is a line of terminal output that matches a search, together with the lines around it.
+type Match struct {
+	// Offset is the offset of the line in the output
+	Offset int
+	Line   string
+	Before []string
+	After  []string
+}
+
+// Search returns the lines of terminal output that match re, without colors and escape sequences,
+// with up to context lines before and after each. It returns at most limit matches, the newest ones,
+// and whether more lines matched.
+func Search(data []byte, re *regexp.Regexp, context int, limit int) ([]Match, bool) {
+	var offsets []int
+	var lines []string
+
+	_ = render(data, func(offset int, line []cell) error {
+		offsets = append(offsets, offset)
+		lines = append(lines, lineText(line))
+		return nil
+	})
+
+	var matched []int
+	for i, line := range lines {
+		if re.MatchString(line) {
+			matched = append(matched, i)
+		}
+	}
+
+	truncated := len(matched) > limit
+	if truncated {
+		// what happened last is what people look for
+		matched = matched[len(matched)-limit:]
+	}
+
+	matches := make([]Match, 0, len(matched))
+	for _, i := range matched {
+		matches = append(matches, Match{
+			Offset: offsets[i],
+			Line:   lines[i],
+			Before: lines[max(0, i-context):i],
+			After:  lines[i+1 : min(len(lines), i+1+context)],
+		})
+	}
+
+	return matches, truncated
+}
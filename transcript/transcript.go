@@ -0,0 +1,231 @@
+package transcript
+
+import (
+	"bufio"
+	"github.com/siriusa51/webtty/vt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	esc = 0x1b
+	bel = 0x07
+)
+
+const tabWidth = 8
+
+// cell is a character on a line together with the style it was written in.
+type cell struct {
+	r     rune
+	style vt.Style
+}
+
+// renderer replays terminal output line by line. It keeps the current line so carriage returns,
+// backspaces and line erases overwrite what they would on a terminal, e.g. progress bars and edited prompts.
+// Sequences that move the cursor between lines or address the screen are dropped.
+type renderer struct {
+	line  []cell
+	col   int
+	style vt.Style
+	emit  func(offset int, line []cell) error
+	// start is the offset of the line in the output
+	start int
+}
+
+func render(data []byte, emit func(offset int, line []cell) error) error {
+	r := &renderer{emit: emit}
+
+	for i := 0; i < len(data); {
+		if data[i] == esc {
+			i += r.escape(data[i:])
+			continue
+		}
+
+		ch, size := utf8.DecodeRune(data[i:])
+		i += size
+
+		switch {
+		case ch == '\n':
+			if err := r.flush(); err != nil {
+				return err
+			}
+			r.start = i
+		case ch == '\r':
+			r.col = 0
+		case ch == '\b':
+			if r.col > 0 {
+				r.col--
+			}
+		case ch == '\t':
+			for next := (r.col/tabWidth + 1) * tabWidth; r.col < next; {
+				r.put(' ')
+			}
+		case ch < 0x20 || ch == 0x7f || (ch >= 0x80 && ch < 0xa0):
+			// other control characters do not print anything
+		default:
+			r.put(ch)
+		}
+	}
+
+	if len(r.line) > 0 {
+		return r.flush()
+	}
+
+	return nil
+}
+
+// put writes ch at the cursor.
+func (r *renderer) put(ch rune) {
+	for len(r.line) < r.col {
+		r.line = append(r.line, cell{r: ' '})
+	}
+
+	c := cell{r: ch, style: r.style}
+	if r.col < len(r.line) {
+		r.line[r.col] = c
+	} else {
+		r.line = append(r.line, c)
+	}
+
+	r.col++
+}
+
+func (r *renderer) flush() error {
+	line := r.line
+	r.line, r.col = nil, 0
+	return r.emit(r.start, line)
+}
+
+// escape handles the escape sequence at the start of data and returns its length.
+// A sequence cut off at the end of data is dropped as a whole.
+func (r *renderer) escape(data []byte) int {
+	if len(data) < 2 {
+		return len(data)
+	}
+
+	switch data[1] {
+	case '[':
+		return r.csi(data)
+	case ']':
+		// OSC, e.g. the window title, ends with BEL or ST
+		return stringEnd(data, true)
+	case 'P', 'X', '^', '_':
+		// DCS, SOS, PM and APC end with ST
+		return stringEnd(data, false)
+	}
+
+	// other sequences are intermediate bytes followed by a final byte, e.g. ESC ( B
+	i := 1
+	for i < len(data) && data[i] >= 0x20 && data[i] <= 0x2f {
+		i++
+	}
+
+	return min(i+1, len(data))
+}
+
+// csi handles a control sequence, only colors, attributes and line erases are applied.
+func (r *renderer) csi(data []byte) int {
+	i := 2
+	for i < len(data) && data[i] >= 0x30 && data[i] <= 0x3f {
+		i++
+	}
+
+	params := string(data[2:i])
+	for i < len(data) && data[i] >= 0x20 && data[i] <= 0x2f {
+		i++
+	}
+
+	if i >= len(data) {
+		return len(data)
+	}
+
+	// a private parameter prefix, e.g. ESC [ ? 2004 h, means the sequence is not a standard one
+	if private := params != "" && params[0] >= 0x3c; !private {
+		switch data[i] {
+		case 'm':
+			r.style.Apply(parseParams(params))
+		case 'K':
+			r.eraseLine(parseParams(params))
+		}
+	}
+
+	return i + 1
+}
+
+func (r *renderer) eraseLine(params []int) {
+	mode := 0
+	if len(params) > 0 {
+		mode = params[0]
+	}
+
+	switch mode {
+	case 0:
+		if r.col < len(r.line) {
+			r.line = r.line[:r.col]
+		}
+	case 1:
+		for i := 0; i <= r.col && i < len(r.line); i++ {
+			r.line[i] = cell{r: ' '}
+		}
+	case 2:
+		r.line = nil
+	}
+}
+
+// stringEnd returns the length of a control string up to and including its terminator.
+func stringEnd(data []byte, allowBel bool) int {
+	for i := 2; i < len(data); i++ {
+		if allowBel && data[i] == bel {
+			return i + 1
+		}
+
+		if data[i] == esc && i+1 < len(data) && data[i+1] == '\\' {
+			return i + 2
+		}
+	}
+
+	return len(data)
+}
+
+// parseParams parses the semicolon separated parameters of a control sequence, a missing parameter is 0.
+func parseParams(params string) []int {
+	if params == "" {
+		return nil
+	}
+
+	fields := strings.Split(params, ";")
+	values := make([]int, 0, len(fields))
+	for _, field := range fields {
+		value, _ := strconv.Atoi(field)
+		values = append(values, value)
+	}
+
+	return values
+}
+
+// lineText returns the characters of a line without trailing spaces.
+func lineText(line []cell) string {
+	var sb strings.Builder
+	for _, c := range line {
+		sb.WriteRune(c.r)
+	}
+
+	return strings.TrimRight(sb.String(), " ")
+}
+
+// Text writes terminal output as plain text, without colors and escape sequences.
+func Text(w io.Writer, data []byte) error {
+	buff := bufio.NewWriter(w)
+
+	err := render(data, func(_ int, line []cell) error {
+		_, err := buff.WriteString(lineText(line) + "\n")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return buff.Flush()
+}
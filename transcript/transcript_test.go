@@ -0,0 +1,84 @@
+package transcript
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"plain", "hello\r\nworld\r\n", "hello\nworld\n"},
+		{"colors", "\x1b[1;31merror\x1b[0m: failed\r\n", "error: failed\n"},
+		{"osc", "\x1b]0;title\x07\x1b]7;file:///tmp\x1b\\$ ls\r\n", "$ ls\n"},
+		{"carriage return", "progress 10%\rprogress 100%\r\n", "progress 100%\n"},
+		{"backspace", "$ lss\b\x1b[K\r\n", "$ ls\n"},
+		{"erase line", "old text\r\x1b[2Knew\r\n", "new\n"},
+		{"private mode", "\x1b[?2004h$ \x1b[?2004l\r\n", "$\n"},
+		{"charset", "\x1b(Bdone", "done\n"},
+		{"tab", "a\tb\r\n", "a       b\n"},
+		{"cut off sequence", "done\x1b[3", "done\n"},
+		{"utf-8", "héllo 世界\r\n", "héllo 世界\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run("test Text() "+tt.name, func(t *testing.T) {
+			var buff bytes.Buffer
+			assert.NoError(t, Text(&buff, []byte(tt.output)))
+			assert.Equal(t, tt.want, buff.String())
+		})
+	}
+}
+
+func TestHTML(t *testing.T) {
+	t.Run("test HTML()", func(t *testing.T) {
+		var buff bytes.Buffer
+		output := "\x1b[1;31merror\x1b[0m: <b>\r\n\x1b[38;5;21mblue\x1b[48;2;1;2;3mbg\x1b[m\r\n\x1b[7minverse\x1b[27m\r\n"
+		assert.NoError(t, HTML(&buff, "session <1>", []byte(output)))
+
+		document := buff.String()
+		assert.Contains(t, document, "<title>session &lt;1&gt;</title>")
+		assert.Contains(t, document, `<span style="color:#cd0000;font-weight:bold">error</span>: &lt;b&gt;`+"\n")
+		assert.Contains(t, document, `<span style="color:#0000ff">blue</span><span style="color:#0000ff;background-color:#010203">bg</span>`)
+		assert.Contains(t, document, `<span style="color:#000000;background-color:#e5e5e5">inverse</span>`)
+		assert.NotContains(t, document, "\x1b")
+	})
+}
+
+func TestSearch(t *testing.T) {
+	output := "$ make\r\n\x1b[1;31merror\x1b[0m: missing file\r\nstep 1\r\nstep 2\r\n$ make test\r\nERROR: 2 failed\r\n"
+
+	t.Run("test Search()", func(t *testing.T) {
+		matches, truncated := Search([]byte(output), regexp.MustCompile(`error`), 1, 10)
+		assert.False(t, truncated)
+		assert.Equal(t, []Match{
+			{Offset: 8, Line: "error: missing file", Before: []string{"$ make"}, After: []string{"step 1"}},
+		}, matches)
+	})
+
+	t.Run("test Search() regex", func(t *testing.T) {
+		matches, truncated := Search([]byte(output), regexp.MustCompile(`(?i)^error:`), 0, 10)
+		assert.False(t, truncated)
+		assert.Len(t, matches, 2)
+		assert.Equal(t, "ERROR: 2 failed", matches[1].Line)
+		assert.Equal(t, 69, matches[1].Offset)
+		assert.Empty(t, matches[1].Before)
+		assert.Empty(t, matches[1].After)
+	})
+
+	t.Run("test Search() limit", func(t *testing.T) {
+		matches, truncated := Search([]byte(output), regexp.MustCompile(`^step`), 5, 1)
+		assert.True(t, truncated)
+		assert.Equal(t, []Match{{
+			Offset: 48,
+			Line:   "step 2",
+			Before: []string{"$ make", "error: missing file", "step 1"},
+			After:  []string{"$ make test", "ERROR: 2 failed"},
+		}}, matches)
+	})
+}
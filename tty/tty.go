@@ -30,6 +30,8 @@ type TTY struct {
 
 	cmd *exec.Cmd
 	pty *os.File
+	// exitCode is set once the process is done
+	exitCode int
 
 	cancelCtx  context.Context
 	cancelFunc context.CancelFunc
@@ -85,6 +87,7 @@ func (c *TTY) waitProcess() {
 		}()
 
 		c.cmd.Wait()
+		c.exitCode = c.cmd.ProcessState.ExitCode()
 	}()
 }
 
@@ -143,6 +146,43 @@ func (c *TTY) GetWindowSize() (int, int, error) {
 	return int(w.col), int(w.row), nil
 }
 
+// Signal sends sig to the foreground process group of the tty.
+func (c *TTY) Signal(sig syscall.Signal) error {
+	var pgrp int32
+
+	if _, _, err := syscall.Syscall(syscall.SYS_IOCTL, c.pty.Fd(), syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgrp))); err != 0 {
+		return fmt.Errorf("failed to get foreground process group: %w", err)
+	}
+
+	if err := syscall.Kill(-int(pgrp), sig); err != nil {
+		return fmt.Errorf("failed to send signal to process group %d: %w", pgrp, err)
+	}
+
+	return nil
+}
+
+// ReadingSecret reports whether the terminal reads lines without echoing them, as programs do while reading a password.
+// Line editors such as readline turn echo off as well, but they read in raw mode and echo the input themselves.
+func (c *TTY) ReadingSecret() (bool, error) {
+	var termios syscall.Termios
+
+	if _, _, err := syscall.Syscall(syscall.SYS_IOCTL, c.pty.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&termios))); err != 0 {
+		return false, fmt.Errorf("failed to get terminal attributes: %w", err)
+	}
+
+	return termios.Lflag&syscall.ECHO == 0 && termios.Lflag&syscall.ICANON != 0, nil
+}
+
+// ExitCode returns the exit code of the process once it is done, -1 if it was killed by a signal.
+func (c *TTY) ExitCode() (int, bool) {
+	select {
+	case <-c.Done():
+		return c.exitCode, true
+	default:
+		return 0, false
+	}
+}
+
 func (c *TTY) Done() <-chan struct{} {
 	return c.cancelCtx.Done()
 }
@@ -167,3 +167,66 @@ func TestCommand_WithEmptyEnv(t *testing.T) {
 		assert.NotContains(t, string(buff), "HELLO=WORLD")
 	})
 }
+
+func TestCommand_Signal(t *testing.T) {
+	t.Run("test Signal()", func(t *testing.T) {
+		cmd, err := New(`sleep 10`)
+		assert.NoError(t, err)
+		defer cmd.Close()
+
+		time.Sleep(100 * time.Millisecond)
+		assert.NoError(t, cmd.Signal(syscall.SIGTERM))
+
+		select {
+		case <-cmd.Done():
+		case <-time.After(time.Second):
+			t.Fatal("process is not terminated by signal")
+		}
+	})
+}
+
+func TestCommand_ExitCode(t *testing.T) {
+	t.Run("test ExitCode()", func(t *testing.T) {
+		cmd, err := New(`false`)
+		assert.NoError(t, err)
+
+		select {
+		case <-cmd.Done():
+		case <-time.After(time.Second):
+			t.Fatal("process is not done")
+		}
+
+		code, ok := cmd.ExitCode()
+		assert.True(t, ok)
+		assert.Equal(t, 1, code)
+	})
+}
+
+func TestCommand_ReadingSecret(t *testing.T) {
+	t.Run("test ReadingSecret()", func(t *testing.T) {
+		cmd, err := New(`sh`)
+		assert.NoError(t, err)
+		defer cmd.Close()
+
+		time.Sleep(100 * time.Millisecond)
+		secret, err := cmd.ReadingSecret()
+		assert.NoError(t, err)
+		assert.False(t, secret)
+
+		_, err = cmd.Write([]byte("stty -echo\n"))
+		assert.NoError(t, err)
+
+		time.Sleep(200 * time.Millisecond)
+		secret, err = cmd.ReadingSecret()
+		assert.NoError(t, err)
+		assert.True(t, secret)
+
+		_, err = cmd.Write([]byte("stty -icanon\n"))
+		assert.NoError(t, err)
+
+		time.Sleep(200 * time.Millisecond)
+		secret, err = cmd.ReadingSecret()
+		assert.NoError(t, err)
+		assert.False(t, secret)
+	})
+}
@@ -0,0 +1,197 @@
+package vt
+
+// Color is the color of a cell: the default color, one of the 256 indexed colors or a 24-bit RGB color.
+type Color uint32
+
+const (
+	DefaultColor Color = 0
+
+	indexedColor Color = 1 << 24
+	rgbColor     Color = 2 << 24
+	colorKind    Color = 0xff << 24
+)
+
+// IndexedColor returns the indexed color n, 0-7 are the basic colors and 8-15 their bright variants.
+func IndexedColor(n uint8) Color {
+	return indexedColor | Color(n)
+}
+
+// RGBColor returns a 24-bit color.
+func RGBColor(r, g, b uint8) Color {
+	return rgbColor | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// Indexed returns the index of an indexed color.
+func (c Color) Indexed() (uint8, bool) {
+	return uint8(c), c&colorKind == indexedColor
+}
+
+// RGB returns the components of a 24-bit color.
+func (c Color) RGB() (uint8, uint8, uint8, bool) {
+	return uint8(c >> 16), uint8(c >> 8), uint8(c), c&colorKind == rgbColor
+}
+
+// Attr is a set of text attributes.
+type Attr uint8
+
+const (
+	Bold Attr = 1 << iota
+	Faint
+	Italic
+	Underline
+	Blink
+	Inverse
+	Hidden
+	Strike
+)
+
+// Style is the graphic rendition a cell is written in.
+type Style struct {
+	Fg    Color
+	Bg    Color
+	Attrs Attr
+}
+
+// Cell is a character on the screen. A wide character takes two cells, the second one has width 0.
+type Cell struct {
+	Rune  rune
+	Width int
+	Style Style
+}
+
+// blank returns an empty cell, erased cells keep the background color of style.
+func blank(style Style) Cell {
+	return Cell{Rune: ' ', Width: 1, Style: Style{Bg: style.Bg}}
+}
+
+// visible returns true if the cell shows anything on the default background.
+func (c Cell) visible() bool {
+	return c.Rune != ' ' || c.Style.Bg != DefaultColor || c.Style.Attrs&(Inverse|Underline|Strike) != 0
+}
+
+// Apply applies the parameters of an SGR sequence, e.g. 1;31 for bold red.
+func (s *Style) Apply(params []int) {
+	if len(params) == 0 {
+		*s = Style{}
+		return
+	}
+
+	for i := 0; i < len(params); i++ {
+		switch p := params[i]; {
+		case p == 0:
+			*s = Style{}
+		case p == 1:
+			s.Attrs |= Bold
+		case p == 2:
+			s.Attrs |= Faint
+		case p == 3:
+			s.Attrs |= Italic
+		case p == 4:
+			s.Attrs |= Underline
+		case p == 5 || p == 6:
+			s.Attrs |= Blink
+		case p == 7:
+			s.Attrs |= Inverse
+		case p == 8:
+			s.Attrs |= Hidden
+		case p == 9:
+			s.Attrs |= Strike
+		case p == 21:
+			s.Attrs |= Underline
+		case p == 22:
+			s.Attrs &^= Bold | Faint
+		case p == 23:
+			s.Attrs &^= Italic
+		case p == 24:
+			s.Attrs &^= Underline
+		case p == 25:
+			s.Attrs &^= Blink
+		case p == 27:
+			s.Attrs &^= Inverse
+		case p == 28:
+			s.Attrs &^= Hidden
+		case p == 29:
+			s.Attrs &^= Strike
+		case p >= 30 && p <= 37:
+			s.Fg = IndexedColor(uint8(p - 30))
+		case p == 38:
+			var n int
+			s.Fg, n = extendedColor(params[i+1:])
+			i += n
+		case p == 39:
+			s.Fg = DefaultColor
+		case p >= 40 && p <= 47:
+			s.Bg = IndexedColor(uint8(p - 40))
+		case p == 48:
+			var n int
+			s.Bg, n = extendedColor(params[i+1:])
+			i += n
+		case p == 49:
+			s.Bg = DefaultColor
+		case p >= 90 && p <= 97:
+			s.Fg = IndexedColor(uint8(p - 90 + 8))
+		case p >= 100 && p <= 107:
+			s.Bg = IndexedColor(uint8(p - 100 + 8))
+		}
+	}
+}
+
+// extendedColor parses the 256 color (5;n) or true color (2;r;g;b) parameters after 38 or 48,
+// it returns the color and how many parameters it used.
+func extendedColor(params []int) (Color, int) {
+	if len(params) >= 2 && params[0] == 5 {
+		return IndexedColor(uint8(clamp(params[1]))), 2
+	}
+
+	if len(params) >= 4 && params[0] == 2 {
+		return RGBColor(uint8(clamp(params[1])), uint8(clamp(params[2])), uint8(clamp(params[3]))), 4
+	}
+
+	return DefaultColor, len(params)
+}
+
+func clamp(v int) int {
+	return max(0, min(v, 255))
+}
+
+// sgr returns the parameters of an SGR sequence that selects s from the default style.
+func (s Style) sgr() []int {
+	params := []int{0}
+
+	attrs := []struct {
+		attr  Attr
+		param int
+	}{
+		{Bold, 1}, {Faint, 2}, {Italic, 3}, {Underline, 4}, {Blink, 5}, {Inverse, 7}, {Hidden, 8}, {Strike, 9},
+	}
+	for _, a := range attrs {
+		if s.Attrs&a.attr != 0 {
+			params = append(params, a.param)
+		}
+	}
+
+	params = append(params, colorParams(s.Fg, 30, 90, 38)...)
+	params = append(params, colorParams(s.Bg, 40, 100, 48)...)
+	return params
+}
+
+// colorParams returns the SGR parameters selecting c, base and bright are the parameters of the
+// basic and bright colors, extended the one of the 256 and true colors.
+func colorParams(c Color, base, bright, extended int) []int {
+	if n, ok := c.Indexed(); ok {
+		switch {
+		case n < 8:
+			return []int{base + int(n)}
+		case n < 16:
+			return []int{bright + int(n) - 8}
+		default:
+			return []int{extended, 5, int(n)}
+		}
+	}
+
+	if r, g, b, ok := c.RGB(); ok {
+		return []int{extended, 2, int(r), int(g), int(b)}
+	}
+
+	return nil
+}
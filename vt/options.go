@@ -0,0 +1,26 @@
+package vt
+
+type options struct {
+	scrollback int
+}
+
+type OptionFunc func(*options)
+
+func newOptions(optfs ...OptionFunc) *options {
+	opt := &options{
+		scrollback: defaultScrollback,
+	}
+
+	for _, optf := range optfs {
+		optf(opt)
+	}
+
+	return opt
+}
+
+// WithScrollback sets how many lines scrolled off the top of the main screen are kept, 0 keeps none.
+func WithScrollback(lines int) OptionFunc {
+	return func(o *options) {
+		o.scrollback = lines
+	}
+}
@@ -0,0 +1,158 @@
+package vt
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// painter writes cells as terminal output, selecting a style only when it changes.
+type painter struct {
+	bytes.Buffer
+	style Style
+}
+
+func (p *painter) setStyle(style Style) {
+	if style == p.style {
+		return
+	}
+
+	p.style = style
+	p.csi('m', style.sgr()...)
+}
+
+func (p *painter) csi(final byte, params ...int) {
+	p.WriteString("\x1b[")
+	for i, param := range params {
+		if i > 0 {
+			p.WriteByte(';')
+		}
+		p.WriteString(strconv.Itoa(param))
+	}
+	p.WriteByte(final)
+}
+
+// setMode sets or resets a DEC private mode.
+func (p *painter) setMode(mode int, set bool) {
+	p.WriteString("\x1b[?" + strconv.Itoa(mode))
+	if set {
+		p.WriteByte('h')
+	} else {
+		p.WriteByte('l')
+	}
+}
+
+// moveTo moves the cursor to column x and row y, counted from 0.
+func (p *painter) moveTo(x, y int) {
+	p.csi('H', y+1, x+1)
+}
+
+// visibleEnd returns the length of line without the cells at its end that show nothing.
+func visibleEnd(line []Cell) int {
+	end := len(line)
+	for end > 0 && !line[end-1].visible() {
+		end--
+	}
+
+	return end
+}
+
+// line writes the cells of a line up to the last visible one.
+func (p *painter) line(line []Cell) {
+	for _, c := range line[:visibleEnd(line)] {
+		if c.Width == 0 {
+			continue
+		}
+
+		p.setStyle(c.Style)
+		p.WriteRune(c.Rune)
+	}
+}
+
+// newLine starts the next line, in the default style so the new line is not erased with a background color.
+func (p *painter) newLine() {
+	p.setStyle(Style{})
+	p.WriteString("\r\n")
+}
+
+// Repaint returns terminal output that resets a terminal of the same size and reproduces the scrollback,
+// the screens, the cursor, the text attributes and the modes of t on it.
+func (t *Terminal) Repaint() []byte {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	p := &painter{}
+	p.WriteString("\x1bc")
+
+	// the main screen is written line by line, so the lines above it scroll into the scrollback
+	for _, line := range t.scrollback {
+		p.line(line)
+		p.newLine()
+	}
+
+	for y, line := range t.main {
+		if y > 0 {
+			p.newLine()
+		}
+		p.line(line)
+	}
+
+	if t.alternate {
+		p.moveTo(t.savedMain.x, t.savedMain.y)
+		p.setStyle(Style{})
+		p.setMode(1049, true)
+
+		for y, line := range t.alt {
+			if visibleEnd(line) > 0 {
+				p.moveTo(0, y)
+				p.line(line)
+			}
+		}
+	}
+
+	if t.top != 0 || t.bottom != t.height-1 {
+		p.csi('r', t.top+1, t.bottom+1)
+	}
+
+	for _, m := range privateModes {
+		if set := t.modes[m.mode]; set != m.set {
+			p.setMode(m.mode, set)
+		}
+	}
+
+	y := t.cur.y
+	if t.cur.origin {
+		p.setMode(6, true)
+		y -= t.top
+	}
+
+	if line, x := t.screen()[t.cur.y], t.cur.x; t.cur.wrap {
+		// writing the last character again leaves the cursor waiting to wrap
+		if line[x].Width == 0 && x > 0 {
+			x--
+		}
+		p.moveTo(x, y)
+		p.setStyle(line[x].Style)
+		p.WriteRune(line[x].Rune)
+	} else {
+		p.moveTo(t.cur.x, y)
+	}
+
+	if t.insert {
+		p.WriteString("\x1b[4h")
+	}
+	if t.appKeypad {
+		p.WriteString("\x1b=")
+	}
+	if t.cur.graphics[0] {
+		p.WriteString("\x1b(0")
+	}
+	if t.cur.graphics[1] {
+		p.WriteString("\x1b)0")
+	}
+	if t.cur.shift {
+		p.WriteByte(0x0e)
+	}
+
+	p.setStyle(t.cur.style)
+	return p.Bytes()
+}
@@ -0,0 +1,246 @@
+package vt
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// palette are the xterm colors of the 16 basic color indexes.
+var palette = [16]string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+const (
+	DefaultForeground = "#e5e5e5"
+	DefaultBackground = "#000000"
+)
+
+// Hex returns the CSS color of c as xterm shows it, empty for the default color.
+func (c Color) Hex() string {
+	if r, g, b, ok := c.RGB(); ok {
+		return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+	}
+
+	n, ok := c.Indexed()
+	switch {
+	case !ok:
+		return ""
+	case n < 16:
+		return palette[n]
+	case n < 232:
+		n -= 16
+		levels := [6]int{0, 95, 135, 175, 215, 255}
+		return fmt.Sprintf("#%02x%02x%02x", levels[n/36], levels[n/6%6], levels[n%6])
+	default:
+		gray := 8 + (int(n)-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", gray, gray, gray)
+	}
+}
+
+// Names returns the names of the attributes in a, e.g. bold.
+func (a Attr) Names() []string {
+	names := []string{"bold", "faint", "italic", "underline", "blink", "inverse", "hidden", "strike"}
+
+	var result []string
+	for i, name := range names {
+		if a&(1<<i) != 0 {
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
+
+// Colors returns the CSS foreground and background colors text in s is shown in, inverse applied.
+// They are empty for the default colors.
+func (s Style) Colors() (string, string) {
+	fg, bg := s.Fg.Hex(), s.Bg.Hex()
+	if s.Attrs&Inverse == 0 {
+		return fg, bg
+	}
+
+	if fg == "" {
+		fg = DefaultForeground
+	}
+	if bg == "" {
+		bg = DefaultBackground
+	}
+
+	return bg, fg
+}
+
+// Snapshot is the screen a terminal shows at one point in time.
+type Snapshot struct {
+	Width, Height int
+	Lines         [][]Cell
+	CursorX       int
+	CursorY       int
+	CursorVisible bool
+	AltScreen     bool
+}
+
+// Snapshot returns a copy of the screen shown.
+func (t *Terminal) Snapshot() Snapshot {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return Snapshot{
+		Width:         t.width,
+		Height:        t.height,
+		Lines:         copyLines(t.screen()),
+		CursorX:       t.cur.x,
+		CursorY:       t.cur.y,
+		CursorVisible: t.modes[25],
+		AltScreen:     t.alternate,
+	}
+}
+
+// Span is a run of cells in the same style starting at column X, Width is the number of cells it takes.
+type Span struct {
+	Text  string
+	Style Style
+	X     int
+	Width int
+}
+
+// Spans splits a line into runs of cells in the same style, cells at its end that show nothing are left out.
+func Spans(line []Cell) []Span {
+	line = line[:visibleEnd(line)]
+
+	var spans []Span
+	for x := 0; x < len(line); {
+		span := Span{Style: line[x].Style, X: x}
+
+		var text strings.Builder
+		for ; x < len(line) && (line[x].Style == span.Style || line[x].Width == 0); x++ {
+			if line[x].Width > 0 {
+				text.WriteRune(line[x].Rune)
+			}
+		}
+
+		span.Text = text.String()
+		span.Width = x - span.X
+		spans = append(spans, span)
+	}
+
+	return spans
+}
+
+// LineText returns the characters of a line without trailing spaces.
+func LineText(line []Cell) string {
+	var text strings.Builder
+	for _, c := range line {
+		if c.Width > 0 {
+			text.WriteRune(c.Rune)
+		}
+	}
+
+	return strings.TrimRight(text.String(), " ")
+}
+
+// Text writes the screen as plain text, without trailing spaces and trailing empty lines.
+func (s Snapshot) Text(w io.Writer) error {
+	rows := make([]string, len(s.Lines))
+	for y, line := range s.Lines {
+		rows[y] = LineText(line)
+	}
+
+	for len(rows) > 0 && rows[len(rows)-1] == "" {
+		rows = rows[:len(rows)-1]
+	}
+
+	buff := bufio.NewWriter(w)
+	for _, row := range rows {
+		buff.WriteString(row)
+		buff.WriteByte('\n')
+	}
+
+	return buff.Flush()
+}
+
+// size of a cell in an SVG, for a 14px monospace font
+const (
+	svgFontSize   = 14
+	svgCellHeight = 18
+	svgBaseline   = 14
+)
+
+// svgWidth returns the width of n cells, which are 8.4 wide.
+func svgWidth(n int) float64 {
+	return float64(n*84) / 10
+}
+
+// SVG writes the screen as an SVG image titled title, with its colors, text attributes and cursor.
+func (s Snapshot) SVG(w io.Writer, title string) error {
+	buff := bufio.NewWriter(w)
+	width, height := svgWidth(s.Width), s.Height*svgCellHeight
+
+	fmt.Fprintf(buff, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%d" viewBox="0 0 %g %d" `+
+		`font-family="Consolas, 'Liberation Mono', Menlo, Courier, monospace" font-size="%d">
+<title>%s</title>
+<rect width="100%%" height="100%%" fill="%s"/>
+`, width, height, width, height, svgFontSize, html.EscapeString(title), DefaultBackground)
+
+	for y, line := range s.Lines {
+		for _, span := range Spans(line) {
+			writeSpan(buff, span, y)
+		}
+	}
+
+	if s.CursorVisible {
+		fmt.Fprintf(buff, `<rect x="%g" y="%d" width="%g" height="%d" fill="%s" opacity="0.5"/>`+"\n",
+			svgWidth(s.CursorX), s.CursorY*svgCellHeight, svgWidth(1), svgCellHeight, DefaultForeground)
+	}
+
+	buff.WriteString("</svg>\n")
+	return buff.Flush()
+}
+
+// writeSpan writes the background and the text of a span on row y.
+func writeSpan(w *bufio.Writer, span Span, y int) {
+	x := svgWidth(span.X)
+	fg, bg := span.Style.Colors()
+
+	if bg != "" {
+		fmt.Fprintf(w, `<rect x="%g" y="%d" width="%g" height="%d" fill="%s"/>`+"\n",
+			x, y*svgCellHeight, svgWidth(span.Width), svgCellHeight, bg)
+	}
+
+	if strings.TrimSpace(span.Text) == "" || span.Style.Attrs&Hidden != 0 {
+		return
+	}
+
+	if fg == "" {
+		fg = DefaultForeground
+	}
+
+	attrs := fmt.Sprintf(`fill="%s"`, fg)
+	if span.Style.Attrs&Bold != 0 {
+		attrs += ` font-weight="bold"`
+	}
+	if span.Style.Attrs&Italic != 0 {
+		attrs += ` font-style="italic"`
+	}
+	if span.Style.Attrs&Faint != 0 {
+		attrs += ` opacity="0.7"`
+	}
+
+	var decorations []string
+	if span.Style.Attrs&Underline != 0 {
+		decorations = append(decorations, "underline")
+	}
+	if span.Style.Attrs&Strike != 0 {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		attrs += fmt.Sprintf(` text-decoration="%s"`, strings.Join(decorations, " "))
+	}
+
+	// the text is stretched to its cells, so wide characters and fallback fonts keep the grid
+	fmt.Fprintf(w, `<text x="%g" y="%d" textLength="%g" lengthAdjust="spacingAndGlyphs" xml:space="preserve" %s>%s</text>`+"\n",
+		x, y*svgCellHeight+svgBaseline, svgWidth(span.Width), attrs, html.EscapeString(span.Text))
+}
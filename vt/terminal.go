@@ -0,0 +1,870 @@
+package vt
+
+import (
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	esc = 0x1b
+	bel = 0x07
+)
+
+const tabWidth = 8
+
+const defaultScrollback = 1000
+
+// DEC private modes a repaint restores, with their state after a reset.
+var privateModes = []struct {
+	mode int
+	set  bool
+}{
+	{1, false},    // application cursor keys
+	{7, true},     // auto wrap
+	{25, true},    // cursor visible
+	{1000, false}, // mouse button reporting
+	{1002, false}, // mouse drag reporting
+	{1003, false}, // mouse motion reporting
+	{1004, false}, // focus reporting
+	{1006, false}, // SGR mouse encoding
+	{2004, false}, // bracketed paste
+}
+
+// decGraphics maps the DEC special graphics character set to the line drawing characters.
+var decGraphics = map[byte]rune{
+	'`': '◆', 'a': '▒', 'f': '°', 'g': '±', 'j': '┘', 'k': '┐', 'l': '┌', 'm': '└', 'n': '┼',
+	'o': '⎺', 'p': '⎻', 'q': '─', 'r': '⎼', 's': '⎽', 't': '├', 'u': '┤', 'v': '┴', 'w': '┬',
+	'x': '│', 'y': '≤', 'z': '≥', '{': 'π', '|': '≠', '}': '£', '~': '·',
+}
+
+type parserState int
+
+const (
+	stateGround parserState = iota
+	// stateEscape follows ESC
+	stateEscape
+	// stateEscapeIntermediate follows ESC and an intermediate byte, e.g. ESC (
+	stateEscapeIntermediate
+	// stateCSI reads the parameters of a control sequence
+	stateCSI
+	// stateString skips the payload of OSC, DCS, APC, PM and SOS strings
+	stateString
+	// stateStringEscape follows ESC inside a string, which ends it if a backslash follows
+	stateStringEscape
+)
+
+// cursor is the cursor position together with the state DECSC saves.
+type cursor struct {
+	x, y  int
+	style Style
+	// wrap is set after writing the last column, the next character goes to the next line
+	wrap bool
+	// graphics tells whether G0 and G1 select the DEC special graphics
+	graphics [2]bool
+	// shift selects G1 instead of G0
+	shift bool
+	// origin makes positions relative to the scroll region
+	origin bool
+}
+
+// Terminal is a headless VT100/xterm emulator. It keeps the screen, the cursor, the text attributes,
+// the alternate screen and the lines scrolled off the top of the main screen, so the screen can be
+// repainted exactly on another terminal. It is safe for concurrent use.
+type Terminal struct {
+	lock sync.Mutex
+
+	width, height int
+	main, alt     [][]Cell
+	alternate     bool
+	scrollback    [][]Cell
+	maxScrollback int
+
+	cur cursor
+	// saved is the cursor saved by DECSC, savedMain the one saved when switching to the alternate screen
+	saved, savedMain cursor
+
+	// top and bottom are the rows of the scroll region
+	top, bottom int
+	modes       map[int]bool
+	insert      bool
+	appKeypad   bool
+	last        rune
+
+	state        parserState
+	params       []byte
+	intermediate []byte
+	pending      []byte
+}
+
+// New returns a terminal with a blank screen of width columns and height rows.
+func New(width, height int, optfs ...OptionFunc) *Terminal {
+	opt := newOptions(optfs...)
+
+	t := &Terminal{
+		width:         max(width, 1),
+		height:        max(height, 1),
+		maxScrollback: opt.scrollback,
+	}
+
+	t.reset()
+	return t
+}
+
+// reset puts everything but the size and the scrollback into the state after power on.
+func (t *Terminal) reset() {
+	t.main = t.blankLines(t.height)
+	t.alt = t.blankLines(t.height)
+	t.alternate = false
+	t.cur = cursor{}
+	t.saved = cursor{}
+	t.savedMain = cursor{}
+	t.top, t.bottom = 0, t.height-1
+	t.insert = false
+	t.appKeypad = false
+
+	t.modes = make(map[int]bool)
+	for _, m := range privateModes {
+		t.modes[m.mode] = m.set
+	}
+}
+
+func (t *Terminal) blankLine() []Cell {
+	line := make([]Cell, t.width)
+	for i := range line {
+		line[i] = blank(Style{})
+	}
+
+	return line
+}
+
+func (t *Terminal) blankLines(n int) [][]Cell {
+	lines := make([][]Cell, n)
+	for i := range lines {
+		lines[i] = t.blankLine()
+	}
+
+	return lines
+}
+
+// screen returns the lines of the active screen.
+func (t *Terminal) screen() [][]Cell {
+	if t.alternate {
+		return t.alt
+	}
+
+	return t.main
+}
+
+// Size returns the number of columns and rows.
+func (t *Terminal) Size() (int, int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.width, t.height
+}
+
+// Cursor returns the column and row of the cursor, counted from 0, and whether it is visible.
+func (t *Terminal) Cursor() (int, int, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.cur.x, t.cur.y, t.modes[25]
+}
+
+// AltScreen returns true while the alternate screen is shown, e.g. by a full screen application.
+func (t *Terminal) AltScreen() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.alternate
+}
+
+// Lines returns a copy of the rows of the screen shown.
+func (t *Terminal) Lines() [][]Cell {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return copyLines(t.screen())
+}
+
+// Scrollback returns a copy of the lines scrolled off the top of the main screen, oldest first.
+func (t *Terminal) Scrollback() [][]Cell {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return copyLines(t.scrollback)
+}
+
+func copyLines(lines [][]Cell) [][]Cell {
+	result := make([][]Cell, len(lines))
+	for i, line := range lines {
+		result[i] = append([]Cell{}, line...)
+	}
+
+	return result
+}
+
+// Resize changes the size of the screen. Lines are cut or padded, not rewrapped;
+// rows that no longer fit above the cursor of the main screen go to the scrollback.
+func (t *Terminal) Resize(width, height int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	width, height = max(width, 1), max(height, 1)
+	if width == t.width && height == t.height {
+		return
+	}
+
+	// keep the cursor on the screen, like xterm does
+	cur := &t.cur
+	if t.alternate {
+		cur = &t.savedMain
+	}
+	if excess := cur.y - (height - 1); excess > 0 {
+		t.pushScrollback(t.main[:excess])
+		t.main = t.main[excess:]
+		cur.y -= excess
+	}
+
+	t.width, t.height = width, height
+	t.main = t.fitLines(t.main)
+	t.alt = t.fitLines(t.alt)
+	t.top, t.bottom = 0, height-1
+
+	for _, c := range []*cursor{&t.cur, &t.saved, &t.savedMain} {
+		c.x, c.y = min(c.x, width-1), min(c.y, height-1)
+		c.wrap = false
+	}
+}
+
+// fitLines cuts or pads lines to the size of the screen.
+func (t *Terminal) fitLines(lines [][]Cell) [][]Cell {
+	if len(lines) > t.height {
+		lines = lines[:t.height]
+	}
+
+	for i, line := range lines {
+		switch {
+		case len(line) > t.width:
+			line = line[:t.width]
+			if line[t.width-1].Width == 2 {
+				line[t.width-1] = blank(line[t.width-1].Style)
+			}
+		case len(line) < t.width:
+			for len(line) < t.width {
+				line = append(line, blank(Style{}))
+			}
+		}
+		lines[i] = line
+	}
+
+	for len(lines) < t.height {
+		lines = append(lines, t.blankLine())
+	}
+
+	return lines
+}
+
+func (t *Terminal) pushScrollback(lines [][]Cell) {
+	if t.maxScrollback <= 0 {
+		return
+	}
+
+	for _, line := range lines {
+		t.scrollback = append(t.scrollback, append([]Cell{}, line...))
+	}
+
+	if excess := len(t.scrollback) - t.maxScrollback; excess > 0 {
+		t.scrollback = t.scrollback[excess:]
+	}
+}
+
+// Write feeds terminal output to the emulator, sequences may be split across writes.
+func (t *Terminal) Write(data []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, b := range data {
+		t.feed(b)
+	}
+
+	return len(data), nil
+}
+
+func (t *Terminal) feed(b byte) {
+	// CAN and SUB abort any sequence
+	if b == 0x18 || b == 0x1a {
+		t.state = stateGround
+		return
+	}
+
+	switch t.state {
+	case stateGround:
+		t.ground(b)
+	case stateEscape:
+		t.escape(b)
+	case stateEscapeIntermediate:
+		if b >= 0x20 && b <= 0x2f {
+			t.intermediate = append(t.intermediate, b)
+			return
+		}
+
+		t.state = stateGround
+		t.escapeDispatch(b)
+	case stateCSI:
+		switch {
+		case b == esc:
+			t.state = stateEscape
+		case b < 0x20:
+			t.control(b)
+		case b <= 0x2f:
+			t.intermediate = append(t.intermediate, b)
+		case b <= 0x3f:
+			t.params = append(t.params, b)
+		case b <= 0x7e:
+			t.state = stateGround
+			t.csi(b)
+		}
+	case stateString:
+		switch b {
+		case bel:
+			t.state = stateGround
+		case esc:
+			t.state = stateStringEscape
+		}
+	case stateStringEscape:
+		switch b {
+		case '\\':
+			t.state = stateGround
+		case esc:
+		default:
+			t.state = stateString
+		}
+	}
+}
+
+func (t *Terminal) ground(b byte) {
+	if len(t.pending) > 0 || b >= 0x80 {
+		t.pending = append(t.pending, b)
+		if !utf8.FullRune(t.pending) {
+			return
+		}
+
+		r, size := utf8.DecodeRune(t.pending)
+		rest := t.pending[size:]
+		t.pending = nil
+		t.print(r)
+
+		// an invalid sequence is replaced, the bytes after it are read again
+		for _, b := range rest {
+			t.feed(b)
+		}
+		return
+	}
+
+	switch {
+	case b == esc:
+		t.state = stateEscape
+	case b < 0x20 || b == 0x7f:
+		t.control(b)
+	default:
+		r := rune(b)
+		if t.cur.graphics[btoi(t.cur.shift)] {
+			if g, ok := decGraphics[b]; ok {
+				r = g
+			}
+		}
+		t.print(r)
+	}
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func (t *Terminal) control(b byte) {
+	switch b {
+	case '\b':
+		if t.cur.x > 0 {
+			t.cur.x--
+		}
+		t.cur.wrap = false
+	case '\t':
+		t.cur.x = min((t.cur.x/tabWidth+1)*tabWidth, t.width-1)
+		t.cur.wrap = false
+	case '\n', '\v', '\f':
+		t.lineFeed()
+	case '\r':
+		t.cur.x = 0
+		t.cur.wrap = false
+	case 0x0e:
+		t.cur.shift = true
+	case 0x0f:
+		t.cur.shift = false
+	}
+}
+
+func (t *Terminal) escape(b byte) {
+	t.params = t.params[:0]
+	t.intermediate = t.intermediate[:0]
+
+	switch {
+	case b == '[':
+		t.state = stateCSI
+	case b == ']' || b == 'P' || b == '_' || b == '^' || b == 'X':
+		t.state = stateString
+	case b >= 0x20 && b <= 0x2f:
+		t.intermediate = append(t.intermediate, b)
+		t.state = stateEscapeIntermediate
+	default:
+		t.state = stateGround
+		t.escapeDispatch(b)
+	}
+}
+
+func (t *Terminal) escapeDispatch(final byte) {
+	if len(t.intermediate) > 0 {
+		switch t.intermediate[0] {
+		case '(':
+			t.cur.graphics[0] = final == '0'
+		case ')':
+			t.cur.graphics[1] = final == '0'
+		case '#':
+			if final == '8' {
+				t.alignmentTest()
+			}
+		}
+		return
+	}
+
+	switch final {
+	case '7':
+		t.saved = t.cur
+	case '8':
+		t.cur = t.saved
+	case 'D':
+		t.lineFeed()
+	case 'E':
+		t.cur.x = 0
+		t.lineFeed()
+	case 'M':
+		t.reverseIndex()
+	case 'c':
+		t.reset()
+	case '=':
+		t.appKeypad = true
+	case '>':
+		t.appKeypad = false
+	}
+}
+
+// alignmentTest fills the screen with E, see DECALN.
+func (t *Terminal) alignmentTest() {
+	for _, line := range t.screen() {
+		for x := range line {
+			line[x] = Cell{Rune: 'E', Width: 1}
+		}
+	}
+	t.top, t.bottom = 0, t.height-1
+	t.cur.x, t.cur.y, t.cur.wrap = 0, 0, false
+}
+
+// print writes r at the cursor.
+func (t *Terminal) print(r rune) {
+	width := runeWidth(r)
+	if width == 0 {
+		return
+	}
+
+	autowrap := t.modes[7]
+	if t.cur.wrap && autowrap {
+		t.cur.x = 0
+		t.lineFeed()
+	}
+	t.cur.wrap = false
+
+	if width == 2 && t.cur.x == t.width-1 {
+		if !autowrap || t.width < 2 {
+			return
+		}
+
+		t.setCell(t.cur.x, t.cur.y, blank(t.cur.style))
+		t.cur.x = 0
+		t.lineFeed()
+	}
+
+	if t.insert {
+		t.insertCells(width)
+	}
+
+	t.setCell(t.cur.x, t.cur.y, Cell{Rune: r, Width: width, Style: t.cur.style})
+	if width == 2 {
+		t.setCell(t.cur.x+1, t.cur.y, Cell{Width: 0, Style: t.cur.style})
+	}
+
+	t.last = r
+	if t.cur.x+width >= t.width {
+		t.cur.x = t.width - 1
+		t.cur.wrap = autowrap
+		return
+	}
+
+	t.cur.x += width
+}
+
+// setCell sets a cell, the rest of a wide character it overwrites is blanked.
+func (t *Terminal) setCell(x, y int, c Cell) {
+	line := t.screen()[y]
+
+	if line[x].Width == 0 && x > 0 && c.Width != 0 {
+		line[x-1] = blank(line[x-1].Style)
+	}
+	if line[x].Width == 2 && x+1 < t.width && c.Width != 2 {
+		line[x+1] = blank(line[x+1].Style)
+	}
+
+	line[x] = c
+}
+
+func (t *Terminal) lineFeed() {
+	t.cur.wrap = false
+
+	switch {
+	case t.cur.y == t.bottom:
+		t.scrollUp(t.top, 1)
+	case t.cur.y < t.height-1:
+		t.cur.y++
+	}
+}
+
+func (t *Terminal) reverseIndex() {
+	t.cur.wrap = false
+
+	switch {
+	case t.cur.y == t.top:
+		t.scrollDown(t.top, 1)
+	case t.cur.y > 0:
+		t.cur.y--
+	}
+}
+
+// scrollUp scrolls the rows from top to the bottom of the scroll region up by n lines,
+// lines leaving the top of the main screen go to the scrollback.
+func (t *Terminal) scrollUp(top, n int) {
+	lines := t.screen()
+	n = min(n, t.bottom-top+1)
+
+	if top == 0 && !t.alternate {
+		t.pushScrollback(lines[:n])
+	}
+
+	copy(lines[top:], lines[top+n:t.bottom+1])
+	for y := t.bottom - n + 1; y <= t.bottom; y++ {
+		lines[y] = t.erasedLine()
+	}
+}
+
+// scrollDown scrolls the rows from top to the bottom of the scroll region down by n lines.
+func (t *Terminal) scrollDown(top, n int) {
+	lines := t.screen()
+	n = min(n, t.bottom-top+1)
+
+	copy(lines[top+n:t.bottom+1], lines[top:])
+	for y := top; y < top+n; y++ {
+		lines[y] = t.erasedLine()
+	}
+}
+
+// deleteLines deletes n lines at the cursor, the lines below move up. Deleted lines never go to the scrollback.
+func (t *Terminal) deleteLines(n int) {
+	lines := t.screen()
+	n = min(n, t.bottom-t.cur.y+1)
+
+	copy(lines[t.cur.y:], lines[t.cur.y+n:t.bottom+1])
+	for y := t.bottom - n + 1; y <= t.bottom; y++ {
+		lines[y] = t.erasedLine()
+	}
+}
+
+// erasedLine returns a line erased with the current background.
+func (t *Terminal) erasedLine() []Cell {
+	line := make([]Cell, t.width)
+	for i := range line {
+		line[i] = blank(t.cur.style)
+	}
+
+	return line
+}
+
+// erase blanks the cells from x0 to x1 (excluded) of row y.
+func (t *Terminal) erase(y, x0, x1 int) {
+	x0, x1 = max(x0, 0), min(x1, t.width)
+	for x := x0; x < x1; x++ {
+		t.setCell(x, y, blank(t.cur.style))
+	}
+}
+
+func (t *Terminal) insertCells(n int) {
+	line := t.screen()[t.cur.y]
+	n = min(n, t.width-t.cur.x)
+
+	copy(line[t.cur.x+n:], line[t.cur.x:])
+	for x := t.cur.x; x < t.cur.x+n; x++ {
+		line[x] = blank(t.cur.style)
+	}
+	t.fixWide(line)
+}
+
+func (t *Terminal) deleteCells(n int) {
+	line := t.screen()[t.cur.y]
+	n = min(n, t.width-t.cur.x)
+
+	copy(line[t.cur.x:], line[t.cur.x+n:])
+	for x := t.width - n; x < t.width; x++ {
+		line[x] = blank(t.cur.style)
+	}
+	t.fixWide(line)
+}
+
+// fixWide blanks the halves of wide characters that were split by shifting a line.
+func (t *Terminal) fixWide(line []Cell) {
+	for x := range line {
+		switch {
+		case line[x].Width == 0 && (x == 0 || line[x-1].Width != 2):
+			line[x] = blank(line[x].Style)
+		case line[x].Width == 2 && (x+1 == len(line) || line[x+1].Width != 0):
+			line[x] = blank(line[x].Style)
+		}
+	}
+}
+
+// moveTo moves the cursor to column x and row y, which are relative to the scroll region in origin mode.
+func (t *Terminal) moveTo(x, y int) {
+	minY, maxY := 0, t.height-1
+	if t.cur.origin {
+		y += t.top
+		minY, maxY = t.top, t.bottom
+	}
+
+	t.cur.x = max(0, min(x, t.width-1))
+	t.cur.y = max(minY, min(y, maxY))
+	t.cur.wrap = false
+}
+
+// moveVertical moves the cursor up or down by n rows, it stops at the margins of the scroll region when inside.
+func (t *Terminal) moveVertical(n int) {
+	minY, maxY := 0, t.height-1
+	if t.cur.y >= t.top && t.cur.y <= t.bottom {
+		minY, maxY = t.top, t.bottom
+	}
+
+	t.cur.y = max(minY, min(t.cur.y+n, maxY))
+	t.cur.wrap = false
+}
+
+func (t *Terminal) csi(final byte) {
+	var marker byte
+	if len(t.params) > 0 && t.params[0] >= '<' && t.params[0] <= '?' {
+		marker = t.params[0]
+	}
+
+	params := parseParams(t.params, marker != 0)
+	param := func(i, def int) int {
+		if i < len(params) && params[i] > 0 {
+			return params[i]
+		}
+		return def
+	}
+
+	if marker == '?' {
+		switch final {
+		case 'h':
+			t.setModes(params, true)
+		case 'l':
+			t.setModes(params, false)
+		}
+		return
+	}
+
+	if marker != 0 || len(t.intermediate) > 0 {
+		return
+	}
+
+	switch final {
+	case '@':
+		t.insertCells(param(0, 1))
+	case 'A':
+		t.moveVertical(-param(0, 1))
+	case 'B', 'e':
+		t.moveVertical(param(0, 1))
+	case 'C', 'a':
+		t.cur.x = min(t.cur.x+param(0, 1), t.width-1)
+		t.cur.wrap = false
+	case 'D':
+		t.cur.x = max(t.cur.x-param(0, 1), 0)
+		t.cur.wrap = false
+	case 'E':
+		t.moveVertical(param(0, 1))
+		t.cur.x = 0
+	case 'F':
+		t.moveVertical(-param(0, 1))
+		t.cur.x = 0
+	case 'G', '`':
+		t.cur.x = min(param(0, 1), t.width) - 1
+		t.cur.wrap = false
+	case 'H', 'f':
+		t.moveTo(param(1, 1)-1, param(0, 1)-1)
+	case 'I':
+		for i := 0; i < param(0, 1); i++ {
+			t.control('\t')
+		}
+	case 'J':
+		t.eraseDisplay(param(0, 0))
+	case 'K':
+		switch param(0, 0) {
+		case 0:
+			t.erase(t.cur.y, t.cur.x, t.width)
+		case 1:
+			t.erase(t.cur.y, 0, t.cur.x+1)
+		case 2:
+			t.erase(t.cur.y, 0, t.width)
+		}
+	case 'L':
+		if t.cur.y >= t.top && t.cur.y <= t.bottom {
+			t.scrollDown(t.cur.y, param(0, 1))
+			t.cur.x = 0
+		}
+	case 'M':
+		if t.cur.y >= t.top && t.cur.y <= t.bottom {
+			t.deleteLines(param(0, 1))
+			t.cur.x = 0
+		}
+	case 'P':
+		t.deleteCells(param(0, 1))
+	case 'S':
+		t.scrollUp(t.top, param(0, 1))
+	case 'T':
+		t.scrollDown(t.top, param(0, 1))
+	case 'X':
+		t.erase(t.cur.y, t.cur.x, t.cur.x+param(0, 1))
+	case 'Z':
+		for i := 0; i < param(0, 1) && t.cur.x > 0; i++ {
+			t.cur.x = (t.cur.x - 1) / tabWidth * tabWidth
+		}
+		t.cur.wrap = false
+	case 'b':
+		if t.last != 0 {
+			for i := 0; i < min(param(0, 1), t.width*t.height); i++ {
+				t.print(t.last)
+			}
+		}
+	case 'd':
+		t.moveTo(t.cur.x, param(0, 1)-1)
+	case 'h', 'l':
+		for _, p := range params {
+			if p == 4 {
+				t.insert = final == 'h'
+			}
+		}
+	case 'm':
+		t.cur.style.Apply(params)
+	case 'r':
+		top, bottom := param(0, 1)-1, min(param(1, t.height), t.height)-1
+		if top < bottom {
+			t.top, t.bottom = top, bottom
+			t.moveTo(0, 0)
+		}
+	case 's':
+		t.saved = t.cur
+	case 'u':
+		t.cur = t.saved
+	}
+}
+
+func (t *Terminal) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		t.erase(t.cur.y, t.cur.x, t.width)
+		for y := t.cur.y + 1; y < t.height; y++ {
+			t.erase(y, 0, t.width)
+		}
+	case 1:
+		for y := 0; y < t.cur.y; y++ {
+			t.erase(y, 0, t.width)
+		}
+		t.erase(t.cur.y, 0, t.cur.x+1)
+	case 2:
+		for y := 0; y < t.height; y++ {
+			t.erase(y, 0, t.width)
+		}
+	case 3:
+		t.scrollback = nil
+	}
+}
+
+func (t *Terminal) setModes(params []int, set bool) {
+	for _, mode := range params {
+		switch mode {
+		case 6:
+			t.cur.origin = set
+			t.moveTo(0, 0)
+		case 47, 1047:
+			t.switchScreen(set, false)
+		case 1048:
+			if set {
+				t.saved = t.cur
+			} else {
+				t.cur = t.saved
+			}
+		case 1049:
+			t.switchScreen(set, true)
+		default:
+			if _, ok := t.modes[mode]; ok {
+				t.modes[mode] = set
+			}
+		}
+	}
+}
+
+// switchScreen shows the alternate screen or goes back to the main screen,
+// entering the alternate screen clears it, saveCursor saves the cursor of the main screen as well.
+func (t *Terminal) switchScreen(alternate, saveCursor bool) {
+	if alternate == t.alternate {
+		return
+	}
+
+	if alternate {
+		t.savedMain = t.cur
+		t.alt = t.blankLines(t.height)
+		t.alternate = true
+		return
+	}
+
+	t.alternate = false
+	if saveCursor {
+		t.cur = t.savedMain
+	}
+}
+
+// parseParams parses the numeric parameters of a control sequence, sub parameters are read as parameters.
+func parseParams(raw []byte, private bool) []int {
+	if private {
+		raw = raw[1:]
+	}
+
+	if len(raw) == 0 {
+		return nil
+	}
+
+	params := []int{0}
+	for _, b := range raw {
+		switch {
+		case b >= '0' && b <= '9':
+			last := &params[len(params)-1]
+			*last = min(*last*10+int(b-'0'), 65535)
+		case b == ';' || b == ':':
+			params = append(params, 0)
+		}
+	}
+
+	return params
+}
@@ -0,0 +1,255 @@
+package vt
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// text returns the rows of the screen shown without trailing spaces.
+func text(term *Terminal) []string {
+	var rows []string
+	for _, line := range term.Lines() {
+		rows = append(rows, LineText(line))
+	}
+
+	return rows
+}
+
+func TestTerminal_Write(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+		x, y   int
+	}{
+		{"plain", "hello\r\nworld", []string{"hello", "world", "", ""}, 5, 1},
+		{"wrap", "abcdefghij", []string{"abcdefgh", "ij", "", ""}, 2, 1},
+		{"pending wrap", "abcdefgh", []string{"abcdefgh", "", "", ""}, 7, 0},
+		{"scroll", "1\r\n2\r\n3\r\n4\r\n5", []string{"2", "3", "4", "5"}, 1, 3},
+		{"cursor position", "\x1b[3;4Hx\x1b[Hy", []string{"y", "", "   x", ""}, 1, 0},
+		{"cursor moves", "\x1b[2B\x1b[3Cx\x1b[A\x1b[2Dy", []string{"", "  y", "   x", ""}, 3, 1},
+		{"erase line", "hello\x1b[3D\x1b[K", []string{"he", "", "", ""}, 2, 0},
+		{"erase display", "a\r\nbcd\x1b[2D\x1b[1J", []string{"", "  d", "", ""}, 1, 1},
+		{"insert and delete chars", "abcdef\x1b[4G\x1b[2@\x1b[G\x1b[P", []string{"bc  def", "", "", ""}, 0, 0},
+		{"erase chars", "abcdef\x1b[2G\x1b[3X", []string{"a   ef", "", "", ""}, 1, 0},
+		{"insert and delete lines", "1\r\n2\r\n3\x1b[2H\x1b[L\x1b[4H\x1b[M", []string{"1", "", "2", ""}, 0, 3},
+		{"scroll region", "\x1b[2;3r\x1b[3H1\n2\n3", []string{"", " 2", "  3", ""}, 3, 2},
+		{"reverse index", "\x1bMtop\x1b[H\x1bM", []string{"", "top", "", ""}, 0, 0},
+		{"tab", "a\tb\tc", []string{"a      c", "", "", ""}, 7, 0},
+		{"backspace", "abc\b\bx", []string{"axc", "", "", ""}, 2, 0},
+		{"repeat", "x\x1b[3b", []string{"xxxx", "", "", ""}, 4, 0},
+		{"save cursor", "\x1b[2;2H\x1b7\x1b[Ha\x1b8b", []string{"a", " b", "", ""}, 2, 1},
+		{"wide", "世界!", []string{"世界!", "", "", ""}, 5, 0},
+		{"wide at the edge", "abcdefg世", []string{"abcdefg", "世", "", ""}, 2, 1},
+		{"overwrite wide", "世界\x1b[2Gx", []string{" x界", "", "", ""}, 2, 0},
+		{"line drawing", "\x1b(0lqk\x1b(Bq", []string{"┌─┐q", "", "", ""}, 4, 0},
+		{"osc and dcs", "\x1b]0;title\x07a\x1bPq#0\x1b\\b", []string{"ab", "", "", ""}, 2, 0},
+		{"split sequence", "\x1b[2", []string{"", "", "", ""}, 0, 0},
+		{"reset", "abc\x1bc", []string{"", "", "", ""}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run("test Write() "+tt.name, func(t *testing.T) {
+			term := New(10, 4)
+			term.Resize(8, 4)
+			_, err := term.Write([]byte(tt.output))
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.want, text(term))
+			x, y, _ := term.Cursor()
+			assert.Equal(t, []int{tt.x, tt.y}, []int{x, y})
+		})
+	}
+
+	t.Run("test Write() split across writes", func(t *testing.T) {
+		term := New(10, 2)
+		for _, part := range []string{"\x1b", "[1;3", "1mr", "\xe4\xb8", "\x96", "\x1b]0;ti", "tle\x1b", "\\x"} {
+			term.Write([]byte(part))
+		}
+
+		assert.Equal(t, []string{"r世x", ""}, text(term))
+		assert.Equal(t, Style{Fg: IndexedColor(1), Attrs: Bold}, term.Lines()[0][0].Style)
+	})
+
+	t.Run("test Write() attributes", func(t *testing.T) {
+		term := New(10, 2)
+		term.Write([]byte("\x1b[1;4;38;5;208;48;2;1;2;3ma\x1b[22;24;39mb\x1b[0;97;101mc\x1b[mX"))
+
+		line := term.Lines()[0]
+		assert.Equal(t, Style{Fg: IndexedColor(208), Bg: RGBColor(1, 2, 3), Attrs: Bold | Underline}, line[0].Style)
+		assert.Equal(t, Style{Bg: RGBColor(1, 2, 3)}, line[1].Style)
+		assert.Equal(t, Style{Fg: IndexedColor(15), Bg: IndexedColor(9)}, line[2].Style)
+		assert.Equal(t, Style{}, line[3].Style)
+	})
+
+	t.Run("test Write() erase keeps the background", func(t *testing.T) {
+		term := New(4, 2)
+		term.Write([]byte("\x1b[44m\x1b[2J"))
+
+		assert.Equal(t, Style{Bg: IndexedColor(4)}, term.Lines()[1][3].Style)
+	})
+}
+
+func TestTerminal_AltScreen(t *testing.T) {
+	t.Run("test AltScreen()", func(t *testing.T) {
+		term := New(10, 3)
+		term.Write([]byte("$ vim\r\n"))
+		term.Write([]byte("\x1b[?1049h\x1b[?25l\x1b[Hfile"))
+
+		assert.True(t, term.AltScreen())
+		assert.Equal(t, []string{"file", "", ""}, text(term))
+		_, _, visible := term.Cursor()
+		assert.False(t, visible)
+
+		term.Write([]byte("\x1b[?1049l\x1b[?25h"))
+		assert.False(t, term.AltScreen())
+		assert.Equal(t, []string{"$ vim", "", ""}, text(term))
+		x, y, _ := term.Cursor()
+		assert.Equal(t, []int{0, 1}, []int{x, y})
+	})
+}
+
+func TestTerminal_Scrollback(t *testing.T) {
+	t.Run("test Scrollback()", func(t *testing.T) {
+		term := New(10, 2, WithScrollback(2))
+		term.Write([]byte("1\r\n2\r\n3\r\n4\r\n5"))
+
+		var lines []string
+		for _, line := range term.Scrollback() {
+			lines = append(lines, LineText(line))
+		}
+		assert.Equal(t, []string{"2", "3"}, lines)
+
+		term.Write([]byte("\x1b[3J"))
+		assert.Empty(t, term.Scrollback())
+	})
+
+	t.Run("test Scrollback() not kept for the alternate screen and regions", func(t *testing.T) {
+		term := New(10, 3)
+		term.Write([]byte("\x1b[?1049h1\r\n2\r\n3\r\n4\x1b[?1049l\x1b[2;3r\x1b[2Ha\nb\nc"))
+
+		assert.Empty(t, term.Scrollback())
+	})
+}
+
+func TestTerminal_Resize(t *testing.T) {
+	t.Run("test Resize()", func(t *testing.T) {
+		term := New(6, 4)
+		term.Write([]byte("1\r\n2\r\n3\r\nabcdef"))
+
+		term.Resize(4, 2)
+		assert.Equal(t, []string{"3", "abcd"}, text(term))
+		assert.Len(t, term.Scrollback(), 2)
+		x, y, _ := term.Cursor()
+		assert.Equal(t, []int{3, 1}, []int{x, y})
+
+		term.Resize(5, 3)
+		assert.Equal(t, []string{"3", "abcd", ""}, text(term))
+		width, height := term.Size()
+		assert.Equal(t, []int{5, 3}, []int{width, height})
+	})
+}
+
+func TestTerminal_Repaint(t *testing.T) {
+	outputs := map[string]string{
+		"shell":        "$ ls\r\n\x1b[1;34mdir\x1b[0m  file\r\n$ echo 世界\r\n世界\r\n$ ",
+		"scrollback":   strings.Repeat("line\r\n", 12) + "\x1b[41mred\x1b[K",
+		"full screen":  "$ top\r\n\x1b[?1049h\x1b[?1h\x1b=\x1b[?25l\x1b[2;5r\x1b[H\x1b[7m PID \x1b[m\r\n\x1b(0lqk\x1b(B\x1b[3;2H",
+		"pending wrap": "abcdefghij\x1b[32m",
+		"modes":        "\x1b[?2004h\x1b[?1000h\x1b[?1006h\x1b[?7l\x1b[4hx",
+		"origin":       "\x1b[3;5r\x1b[?6h\x1b[2;3Hx",
+	}
+
+	for name, output := range outputs {
+		t.Run("test Repaint() "+name, func(t *testing.T) {
+			term := New(10, 6)
+			term.Write([]byte(output))
+
+			repainted := New(10, 6)
+			repainted.Write([]byte("garbage\r\n\x1b[31mto be reset"))
+			repainted.Write(term.Repaint())
+
+			assert.Equal(t, term.main, repainted.main)
+			assert.Equal(t, term.alternate, repainted.alternate)
+			if term.alternate {
+				assert.Equal(t, term.alt, repainted.alt)
+				assert.Equal(t, term.savedMain.x, repainted.savedMain.x)
+				assert.Equal(t, term.savedMain.y, repainted.savedMain.y)
+			}
+			assert.Equal(t, term.scrollback, repainted.scrollback)
+			assert.Equal(t, term.cur, repainted.cur)
+			assert.Equal(t, term.modes, repainted.modes)
+			assert.Equal(t, [2]int{term.top, term.bottom}, [2]int{repainted.top, repainted.bottom})
+			assert.Equal(t, term.insert, repainted.insert)
+			assert.Equal(t, term.appKeypad, repainted.appKeypad)
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Run("test Snapshot()", func(t *testing.T) {
+		term := New(10, 3)
+		term.Write([]byte("$ top\r\n\x1b[?1049h\x1b[?25l\x1b[2;3Hload"))
+
+		snapshot := term.Snapshot()
+		assert.Equal(t, 10, snapshot.Width)
+		assert.Equal(t, 3, snapshot.Height)
+		assert.True(t, snapshot.AltScreen)
+		assert.False(t, snapshot.CursorVisible)
+		assert.Equal(t, []int{6, 1}, []int{snapshot.CursorX, snapshot.CursorY})
+		assert.Equal(t, "  load", LineText(snapshot.Lines[1]))
+	})
+
+	t.Run("test Text()", func(t *testing.T) {
+		term := New(10, 4)
+		term.Write([]byte("\x1b[31mred\x1b[m  \r\n\r\n世界"))
+
+		var buff strings.Builder
+		assert.NoError(t, term.Snapshot().Text(&buff))
+		assert.Equal(t, "red\n\n世界\n", buff.String())
+	})
+
+	t.Run("test SVG()", func(t *testing.T) {
+		term := New(10, 2)
+		term.Write([]byte("\x1b[1;31m<err>\x1b[m ok\r\n\x1b[7mhi\x1b[m"))
+
+		var buff strings.Builder
+		assert.NoError(t, term.Snapshot().SVG(&buff, "session <1>"))
+
+		svg := buff.String()
+		assert.Contains(t, svg, `width="84" height="36"`)
+		assert.Contains(t, svg, "<title>session &lt;1&gt;</title>")
+		assert.Contains(t, svg, `<text x="0" y="14" textLength="42" lengthAdjust="spacingAndGlyphs" xml:space="preserve" fill="#cd0000" font-weight="bold">&lt;err&gt;</text>`)
+		assert.Contains(t, svg, `xml:space="preserve" fill="#e5e5e5"> ok</text>`)
+		assert.Contains(t, svg, `<rect x="0" y="18" width="16.8" height="18" fill="#e5e5e5"/>`)
+		assert.Contains(t, svg, `fill="#000000">hi</text>`)
+		assert.Contains(t, svg, `<rect x="16.8" y="18" width="8.4" height="18" fill="#e5e5e5" opacity="0.5"/>`)
+	})
+}
+
+func TestSpans(t *testing.T) {
+	t.Run("test Spans()", func(t *testing.T) {
+		term := New(10, 1)
+		term.Write([]byte("a世\x1b[32mb\x1b[44m \x1b[m  "))
+
+		spans := Spans(term.Lines()[0])
+		assert.Equal(t, []Span{
+			{Text: "a世", X: 0, Width: 3},
+			{Text: "b", Style: Style{Fg: IndexedColor(2)}, X: 3, Width: 1},
+			{Text: " ", Style: Style{Fg: IndexedColor(2), Bg: IndexedColor(4)}, X: 4, Width: 1},
+		}, spans)
+	})
+}
+
+func TestColor_Hex(t *testing.T) {
+	t.Run("test Hex()", func(t *testing.T) {
+		assert.Equal(t, "", DefaultColor.Hex())
+		assert.Equal(t, "#cd0000", IndexedColor(1).Hex())
+		assert.Equal(t, "#000000", IndexedColor(16).Hex())
+		assert.Equal(t, "#ffffff", IndexedColor(231).Hex())
+		assert.Equal(t, "#080808", IndexedColor(232).Hex())
+		assert.Equal(t, "#eeeeee", IndexedColor(255).Hex())
+		assert.Equal(t, "#0a0b0c", RGBColor(10, 11, 12).Hex())
+	})
+}
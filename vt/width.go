@@ -0,0 +1,48 @@
+package vt
+
+import "unicode"
+
+// wideRanges are the East Asian wide and fullwidth characters, as xterm.js counts them by default.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f},
+	{0x2329, 0x232a},
+	{0x2e80, 0x303e},
+	{0x3041, 0x33ff},
+	{0x3400, 0x4dbf},
+	{0x4e00, 0x9fff},
+	{0xa000, 0xa4cf},
+	{0xac00, 0xd7a3},
+	{0xf900, 0xfaff},
+	{0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f},
+	{0xff00, 0xff60},
+	{0xffe0, 0xffe6},
+	{0x20000, 0x2fffd},
+	{0x30000, 0x3fffd},
+}
+
+// runeWidth returns how many cells r takes, 0 for combining and format characters.
+func runeWidth(r rune) int {
+	if r < 0x300 {
+		return 1
+	}
+
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) || (r >= 0x1160 && r <= 0x11ff) {
+		return 0
+	}
+
+	lo, hi := 0, len(wideRanges)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		switch {
+		case r < wideRanges[mid][0]:
+			hi = mid
+		case r > wideRanges[mid][1]:
+			lo = mid + 1
+		default:
+			return 2
+		}
+	}
+
+	return 1
+}